@@ -14,6 +14,7 @@ const (
 )
 
 var supportedTransportProtocol = map[AddressFamilyAndProtocol]bool{
+	UNSPEC:       true,
 	TCPv4:        true,
 	UDPv4:        true,
 	TCPv6:        true,
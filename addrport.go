@@ -0,0 +1,104 @@
+package proxyproto
+
+import (
+	"bufio"
+	"net"
+	"net/netip"
+)
+
+// AddrPortHeader is a proxy protocol header whose addresses are stored as
+// netip.AddrPort values. Unlike Header, it can be read without allocating.
+type AddrPortHeader struct {
+	Version           byte
+	Command           ProtocolVersionAndCommand
+	TransportProtocol AddressFamilyAndProtocol
+	SourceAddr        netip.AddrPort
+	DestinationAddr   netip.AddrPort
+}
+
+// HeaderProxyFromAddrPorts creates a new PROXY header from a source and a
+// destination address on the given network, "tcp" or "udp". As for
+// HeaderProxyFromAddrs, a LOCAL header with an UNSPEC transport protocol is
+// returned if the network is unknown or the addresses aren't of the same
+// family.
+func HeaderProxyFromAddrPorts(version byte, network string, sourceAddr, destAddr netip.AddrPort) *Header {
+	switch network {
+	case "tcp":
+		return HeaderProxyFromAddrs(version, net.TCPAddrFromAddrPort(sourceAddr), net.TCPAddrFromAddrPort(destAddr))
+	case "udp":
+		return HeaderProxyFromAddrs(version, net.UDPAddrFromAddrPort(sourceAddr), net.UDPAddrFromAddrPort(destAddr))
+	default:
+		return HeaderProxyFromAddrs(version, nil, nil)
+	}
+}
+
+// AddrPorts returns the source and destination addresses of a TCP or UDP
+// header, and false otherwise. Addresses of IPv4 headers are unmapped.
+func (header *Header) AddrPorts() (sourceAddr, destAddr netip.AddrPort, ok bool) {
+	sourceIP, destIP, ok := header.IPs()
+	if !ok {
+		return netip.AddrPort{}, netip.AddrPort{}, false
+	}
+	sourcePort, destPort, _ := header.Ports()
+
+	source, sourceOK := netip.AddrFromSlice(sourceIP)
+	dest, destOK := netip.AddrFromSlice(destIP)
+	if !sourceOK || !destOK {
+		return netip.AddrPort{}, netip.AddrPort{}, false
+	}
+	if header.TransportProtocol.IsIPv4() {
+		source, dest = source.Unmap(), dest.Unmap()
+	}
+
+	return netip.AddrPortFrom(source, uint16(sourcePort)), netip.AddrPortFrom(dest, uint16(destPort)), true
+}
+
+// ReadAddrPortHeader acts as Read but returns an AddrPortHeader. Version 2
+// headers are decoded in place from the reader buffer, without allocating.
+// TLVs are skipped, use Read to access them. Unix addresses aren't
+// represented and are left zero.
+func ReadAddrPortHeader(reader *bufio.Reader) (AddrPortHeader, error) {
+	version, err := peekVersion(reader)
+	if err != nil {
+		return AddrPortHeader{}, err
+	}
+	if version == 1 {
+		header, err := parseVersion1(reader)
+		if err != nil {
+			return AddrPortHeader{}, err
+		}
+		addrPortHeader := AddrPortHeader{
+			Version:           header.Version,
+			Command:           header.Command,
+			TransportProtocol: header.TransportProtocol,
+		}
+		addrPortHeader.SourceAddr, addrPortHeader.DestinationAddr, _ = header.AddrPorts()
+		return addrPortHeader, nil
+	}
+
+	command, transportProtocol, payload, err := readVersion2Preamble(reader, 0)
+	if err != nil {
+		return AddrPortHeader{}, err
+	}
+
+	header := AddrPortHeader{
+		Version:           2,
+		Command:           command,
+		TransportProtocol: transportProtocol,
+	}
+	if transportProtocol.IsIPv4() {
+		sourceIP, destIP, sourcePort, destPort := parseVersion2IPAddresses(payload, net.IPv4len)
+		header.SourceAddr = netip.AddrPortFrom(netip.AddrFrom4(*(*[4]byte)(sourceIP)), sourcePort)
+		header.DestinationAddr = netip.AddrPortFrom(netip.AddrFrom4(*(*[4]byte)(destIP)), destPort)
+	} else if transportProtocol.IsIPv6() {
+		sourceIP, destIP, sourcePort, destPort := parseVersion2IPAddresses(payload, net.IPv6len)
+		header.SourceAddr = netip.AddrPortFrom(netip.AddrFrom16(*(*[16]byte)(sourceIP)), sourcePort)
+		header.DestinationAddr = netip.AddrPortFrom(netip.AddrFrom16(*(*[16]byte)(destIP)), destPort)
+	}
+
+	if _, err := reader.Discard(len(payload)); err != nil {
+		return AddrPortHeader{}, newParseError(2, "payload", lengthV2Preamble, ErrInvalidLength)
+	}
+
+	return header, nil
+}
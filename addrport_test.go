@@ -0,0 +1,228 @@
+package proxyproto
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+var (
+	fixtureIPv4V2AddrPortHeader = append(append(SIGV2, byte(PROXY), byte(TCPv4)), fixtureIPv4V2...)
+	fixtureIPv6V2AddrPortHeader = append(append(SIGV2, byte(PROXY), byte(TCPv6)), fixtureIPv6V2...)
+)
+
+func TestHeaderProxyFromAddrPorts(t *testing.T) {
+	sourceAddr := netip.MustParseAddrPort("10.1.1.1:1000")
+	destAddr := netip.MustParseAddrPort("20.2.2.2:2000")
+
+	tests := []struct {
+		network  string
+		expected AddressFamilyAndProtocol
+	}{
+		{"tcp", TCPv4},
+		{"udp", UDPv4},
+		{"unix", UNSPEC},
+	}
+
+	for _, tt := range tests {
+		header := HeaderProxyFromAddrPorts(2, tt.network, sourceAddr, destAddr)
+		if header.TransportProtocol != tt.expected {
+			t.Fatalf("%s: expected %v, actual %v", tt.network, tt.expected, header.TransportProtocol)
+		}
+		if tt.expected == UNSPEC {
+			if header.Command != LOCAL {
+				t.Fatalf("%s: expected a LOCAL header, actual %v", tt.network, header.Command)
+			}
+			continue
+		}
+
+		source, dest, ok := header.AddrPorts()
+		if !ok {
+			t.Fatalf("%s: expected addresses", tt.network)
+		}
+		if source != sourceAddr || dest != destAddr {
+			t.Fatalf("%s: expected %v %v, actual %v %v", tt.network, sourceAddr, destAddr, source, dest)
+		}
+	}
+}
+
+func TestHeaderProxyFromAddrPortsMixedFamilies(t *testing.T) {
+	header := HeaderProxyFromAddrPorts(2, "tcp", netip.MustParseAddrPort("10.1.1.1:1000"), netip.MustParseAddrPort("[::1]:2000"))
+	if header.TransportProtocol != UNSPEC || header.Command != LOCAL {
+		t.Fatalf("expected a LOCAL UNSPEC header, actual %v %v", header.Command, header.TransportProtocol)
+	}
+}
+
+func TestAddrPortsUnmapsIPv4(t *testing.T) {
+	header := &Header{
+		Version:           1,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+		DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("20.2.2.2"), Port: 2000},
+	}
+
+	source, dest, ok := header.AddrPorts()
+	if !ok {
+		t.Fatal("expected addresses")
+	}
+	if !source.Addr().Is4() || !dest.Addr().Is4() {
+		t.Fatalf("expected IPv4 addresses, actual %v %v", source, dest)
+	}
+}
+
+func TestAddrPortsWithoutIPs(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: UnixStream,
+		SourceAddr:        &net.UnixAddr{Net: "unix", Name: "/run/src.sock"},
+		DestinationAddr:   &net.UnixAddr{Net: "unix", Name: "/run/dst.sock"},
+	}
+
+	if _, _, ok := header.AddrPorts(); ok {
+		t.Fatal("expected no addresses")
+	}
+}
+
+func TestReadAddrPortHeader(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      []byte
+		expected AddrPortHeader
+	}{
+		{
+			"v2 IPv4",
+			fixtureIPv4V2AddrPortHeader,
+			AddrPortHeader{2, PROXY, TCPv4, netip.AddrPortFrom(netip.MustParseAddr(IP4_ADDR), PORT), netip.AddrPortFrom(netip.MustParseAddr(IP4_ADDR), PORT)},
+		},
+		{
+			"v2 IPv6",
+			fixtureIPv6V2AddrPortHeader,
+			AddrPortHeader{2, PROXY, TCPv6, netip.AddrPortFrom(netip.MustParseAddr(IP6_ADDR), PORT), netip.AddrPortFrom(netip.MustParseAddr(IP6_ADDR), PORT)},
+		},
+		{
+			"v2 IPv4 with TLVs",
+			append(append(SIGV2, byte(PROXY), byte(UDPv4)), fixtureIPv4V2TLV...),
+			AddrPortHeader{2, PROXY, UDPv4, netip.AddrPortFrom(netip.MustParseAddr(IP4_ADDR), PORT), netip.AddrPortFrom(netip.MustParseAddr(IP4_ADDR), PORT)},
+		},
+		{
+			"v1 TCP4",
+			[]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n"),
+			AddrPortHeader{1, PROXY, TCPv4, netip.MustParseAddrPort("10.1.1.1:1000"), netip.MustParseAddrPort("20.2.2.2:2000")},
+		},
+	}
+
+	for _, tt := range tests {
+		reader := newBufioReader(append(append([]byte(nil), tt.raw...), arbitraryTailBytes...))
+
+		header, err := ReadAddrPortHeader(reader)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if header != tt.expected {
+			t.Fatalf("%s: expected %+v, actual %+v", tt.name, tt.expected, header)
+		}
+
+		tail := make([]byte, len(arbitraryTailBytes))
+		if _, err := reader.Read(tail); err != nil || !bytes.Equal(tail, arbitraryTailBytes) {
+			t.Fatalf("%s: expected the header to be consumed, actual tail %v (%v)", tt.name, tail, err)
+		}
+	}
+}
+
+func TestReadAddrPortHeaderInvalid(t *testing.T) {
+	if _, err := ReadAddrPortHeader(newBufioReader([]byte("GET / HTTP/1.1\r\n"))); err != ErrNoProxyProtocol {
+		t.Fatalf("expected %v, actual %v", ErrNoProxyProtocol, err)
+	}
+
+	truncated := fixtureIPv6V2AddrPortHeader[:len(fixtureIPv6V2AddrPortHeader)-1]
+	if _, err := ReadAddrPortHeader(newBufioReader(truncated)); !errors.Is(err, ErrInvalidLength) {
+		t.Fatalf("expected %v, actual %v", ErrInvalidLength, err)
+	}
+}
+
+func TestReadAddrPortHeaderShortNonProxyInput(t *testing.T) {
+	// The client sends less than a v2 signature then waits for a reply
+	for _, payload := range []string{"ping", "\r\n\r\nX", "PROBE"} {
+		server, client := net.Pipe()
+		go client.Write([]byte(payload))
+
+		result := make(chan error, 1)
+		go func() {
+			_, err := ReadAddrPortHeader(bufio.NewReader(server))
+			result <- err
+		}()
+
+		select {
+		case err := <-result:
+			if err != ErrNoProxyProtocol {
+				t.Fatalf("%q: expected %v, actual %v", payload, ErrNoProxyProtocol, err)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%q: ReadAddrPortHeader blocked on short input", payload)
+		}
+		server.Close()
+		client.Close()
+	}
+}
+
+func TestReadAddrPortHeaderDoesNotAllocate(t *testing.T) {
+	for _, raw := range [][]byte{fixtureIPv4V2AddrPortHeader, fixtureIPv6V2AddrPortHeader} {
+		data := bytes.NewReader(raw)
+		reader := bufio.NewReader(data)
+
+		allocs := testing.AllocsPerRun(100, func() {
+			data.Reset(raw)
+			reader.Reset(data)
+			if _, err := ReadAddrPortHeader(reader); err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+		if allocs != 0 {
+			t.Fatalf("expected no allocation, actual %v", allocs)
+		}
+	}
+}
+
+func benchmarkReadAddrPortHeader(b *testing.B, raw []byte) {
+	data := bytes.NewReader(raw)
+	reader := bufio.NewReader(data)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data.Reset(raw)
+		reader.Reset(data)
+		if _, err := ReadAddrPortHeader(reader); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReadAddrPortHeaderV2IPv4(b *testing.B) {
+	benchmarkReadAddrPortHeader(b, fixtureIPv4V2AddrPortHeader)
+}
+
+func BenchmarkReadAddrPortHeaderV2IPv6(b *testing.B) {
+	benchmarkReadAddrPortHeader(b, fixtureIPv6V2AddrPortHeader)
+}
+
+func BenchmarkReadV2IPv4(b *testing.B) {
+	data := bytes.NewReader(fixtureIPv4V2AddrPortHeader)
+	reader := bufio.NewReader(data)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		data.Reset(fixtureIPv4V2AddrPortHeader)
+		reader.Reset(data)
+		if _, err := Read(reader); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package proxyproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+)
+
+var (
+	ErrInvalidChecksum = errors.New("Invalid CRC32C checksum")
+
+	crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// ValidateCRC32C is a Validator which rejects v2 headers carrying a
+// PP2_TYPE_CRC32C TLV whose value doesn't match the checksum of the header,
+// see section 2.2.2. Headers without such TLV are accepted, while headers
+// whose TLVs can't be split or whose PP2_TYPE_CRC32C TLV isn't 4 bytes long
+// are rejected with ErrTruncatedTLV or ErrMalformedTLV.
+//
+// For a header returned by Read or Parse, the checksum is computed over the
+// bytes received, so that e.g. bytes following the NUL terminator of a Unix
+// socket path are covered even though they aren't part of the address.
+func ValidateCRC32C(header *Header) error {
+	if header.Version != 2 {
+		return nil
+	}
+	offset, err := crc32cOffset(header.rawTLVs)
+	if err != nil || offset < 0 {
+		return err
+	}
+
+	addresses := header.rawAddresses
+	if addresses == nil {
+		// The header wasn't received, format it to get its address block
+		raw, err := header.formatVersion2()
+		if err != nil {
+			return err
+		}
+		addresses = raw[lengthV2Preamble : len(raw)-len(header.rawTLVs)]
+	}
+
+	preamble := make([]byte, lengthV2Preamble)
+	copy(preamble, SIGV2)
+	preamble[12] = header.Command.toByte()
+	preamble[13] = header.TransportProtocol.toByte()
+	binary.BigEndian.PutUint16(preamble[14:], uint16(len(addresses)+len(header.rawTLVs)))
+
+	checksum := crc32.Update(0, crc32cTable, preamble)
+	checksum = crc32.Update(checksum, crc32cTable, addresses)
+	checksum = crc32.Update(checksum, crc32cTable, header.rawTLVs[:offset])
+	checksum = crc32.Update(checksum, crc32cTable, []byte{0, 0, 0, 0})
+	checksum = crc32.Update(checksum, crc32cTable, header.rawTLVs[offset+4:])
+	if checksum != binary.BigEndian.Uint32(header.rawTLVs[offset:]) {
+		return ErrInvalidChecksum
+	}
+	return nil
+}
+
+// fillCRC32C computes the checksum of a formatted v2 header and stores it in
+// the PP2_TYPE_CRC32C TLV value, if any. rawTLVs must be the tail of raw.
+func fillCRC32C(raw, rawTLVs []byte) {
+	offset, err := crc32cOffset(rawTLVs)
+	if err != nil || offset < 0 {
+		return
+	}
+
+	checksum := raw[len(raw)-len(rawTLVs)+offset:][:4]
+	copy(checksum, []byte{0, 0, 0, 0})
+	binary.BigEndian.PutUint32(checksum, crc32.Checksum(raw, crc32cTable))
+}
+
+// crc32cOffset returns the offset of the first PP2_TYPE_CRC32C value in the
+// TLV vector, or -1 if there is none. It errors with ErrTruncatedTLV if the
+// vector can't be split, and with ErrMalformedTLV if the value of the
+// PP2_TYPE_CRC32C TLV isn't 4 bytes long.
+func crc32cOffset(rawTLVs []byte) (int, error) {
+	offset := -1
+	for i := 0; i < len(rawTLVs); {
+		if len(rawTLVs)-i < 3 {
+			return -1, ErrTruncatedTLV
+		}
+		length := int(binary.BigEndian.Uint16(rawTLVs[i+1 : i+3]))
+		if i+3+length > len(rawTLVs) {
+			return -1, ErrTruncatedTLV
+		}
+		if PP2Type(rawTLVs[i]) == PP2_TYPE_CRC32C && offset < 0 {
+			if length != 4 {
+				return -1, ErrMalformedTLV
+			}
+			offset = i + 3
+		}
+		i += 3 + length
+	}
+	return offset, nil
+}
@@ -0,0 +1,184 @@
+package proxyproto
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"net"
+	"testing"
+)
+
+func crc32cHeader(t *testing.T) *Header {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
+	}
+	err := header.SetTLVs([]TLV{
+		{Type: PP2_TYPE_ALPN, Value: []byte("h2")},
+		{Type: PP2_TYPE_CRC32C, Value: make([]byte, 4)},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	return header
+}
+
+func TestFormatComputesCRC32C(t *testing.T) {
+	raw, err := crc32cHeader(t).Format()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	header, err := Read(newBufioReader(raw))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	tlvs, err := header.TLVs()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if bytes.Equal(tlvs[1].Value, make([]byte, 4)) {
+		t.Fatal("expected CRC32C to be computed")
+	}
+	if err := ValidateCRC32C(header); err != nil {
+		t.Fatalf("expected valid checksum, got %v", err)
+	}
+}
+
+func TestFormatDoesNotModifyHeaderTLVs(t *testing.T) {
+	header := crc32cHeader(t)
+	rawTLVs := append([]byte{}, header.rawTLVs...)
+	if _, err := header.Format(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !bytes.Equal(rawTLVs, header.rawTLVs) {
+		t.Fatalf("expected %#v, actual %#v", rawTLVs, header.rawTLVs)
+	}
+}
+
+func TestValidateCRC32CRejectsCorruptedHeader(t *testing.T) {
+	raw, err := crc32cHeader(t).Format()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Corrupt the source address
+	raw[16]++
+
+	header, err := Read(newBufioReader(raw))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := ValidateCRC32C(header); err != ErrInvalidChecksum {
+		t.Fatalf("expected %v, actual %v", ErrInvalidChecksum, err)
+	}
+}
+
+func TestValidateCRC32CAcceptsHeadersWithoutChecksum(t *testing.T) {
+	header, err := Read(newBufioReader(append(append(SIGV2, PROXY, TCPv4), fixtureIPv4V2...)))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := ValidateCRC32C(header); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestValidateCRC32CRejectsMalformedTLVs(t *testing.T) {
+	raw, err := crc32cHeader(t).Format()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Flip a bit in the length of the CRC32C TLV, which follows the ALPN one
+	raw[lengthV2Preamble+lengthV4+5+2] ^= 0x01
+
+	header, err := Read(newBufioReader(raw))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := ValidateCRC32C(header); !errors.Is(err, ErrTruncatedTLV) {
+		t.Fatalf("expected %v, actual %v", ErrTruncatedTLV, err)
+	}
+
+	// A CRC32C TLV must hold 4 bytes
+	header = crc32cHeader(t)
+	err = header.SetTLVs([]TLV{
+		{Type: PP2_TYPE_CRC32C, Value: make([]byte, 3)},
+		{Type: PP2_TYPE_ALPN, Value: []byte("h2")},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := ValidateCRC32C(header); !errors.Is(err, ErrMalformedTLV) {
+		t.Fatalf("expected %v, actual %v", ErrMalformedTLV, err)
+	}
+}
+
+func TestValidateCRC32CCoversBytesAfterUnixPath(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: UnixStream,
+		SourceAddr:        &net.UnixAddr{Net: "unix", Name: "/var/run/src.sock"},
+		DestinationAddr:   &net.UnixAddr{Net: "unix", Name: "/var/run/dst.sock"},
+	}
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_CRC32C, Value: make([]byte, 4)}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	raw, err := header.Format()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// Some senders don't zero the bytes following the NUL terminator,
+	// compute the checksum as they would
+	copy(raw[lengthV2Preamble+len("/var/run/src.sock")+1:], "garbage")
+	checksum := raw[len(raw)-4:]
+	copy(checksum, []byte{0, 0, 0, 0})
+	binary.BigEndian.PutUint32(checksum, crc32.Checksum(raw, crc32cTable))
+
+	received, err := Read(newBufioReader(raw))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if received.SourceAddr.String() != "/var/run/src.sock" {
+		t.Fatalf("bad: %v", received.SourceAddr)
+	}
+	if err := ValidateCRC32C(received); err != nil {
+		t.Fatalf("expected valid checksum, got %v", err)
+	}
+
+	// The garbage is covered by the checksum
+	raw[lengthV2Preamble+len("/var/run/src.sock")+1]++
+	received, err = Read(newBufioReader(raw))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := ValidateCRC32C(received); err != ErrInvalidChecksum {
+		t.Fatalf("expected %v, actual %v", ErrInvalidChecksum, err)
+	}
+}
+
+func TestValidateCRC32COfBuiltHeader(t *testing.T) {
+	header := crc32cHeader(t)
+	raw, err := header.Format()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// Checked by formatting the header, as it wasn't received
+	header.rawTLVs = raw[lengthV2Preamble+lengthV4:]
+	if err := ValidateCRC32C(header); err != nil {
+		t.Fatalf("expected valid checksum, got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package proxyproto
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+)
+
+// ErrNoHeaderToWrite is returned by Dialer when neither a header template
+// nor a header function has been configured.
+var ErrNoHeaderToWrite = errors.New("Dialer has neither Header nor HeaderFunc set")
+
+// HeaderFunc builds the proxy protocol header to send over a connection
+// established from the source address to the destination address. The
+// context is the one the connection was dialed with, so that callers can
+// pass per-request values through, such as the address of the client
+// whose connection is being proxied.
+type HeaderFunc func(ctx context.Context, source, destination net.Addr) (*Header, error)
+
+// Dialer mirrors net.Dialer but writes a proxy protocol header on every
+// connection it establishes, before handing it back to the caller.
+type Dialer struct {
+	// Dialer is used to establish the underlying connection. If nil, a zero
+	// net.Dialer is used.
+	Dialer *net.Dialer
+	// Header is the header template written on every connection. Its Version
+	// field decides whether a v1 or v2 header is written.
+	Header *Header
+	// HeaderFunc, if set, takes precedence over Header. It receives the
+	// context passed to DialContext along with the local and remote
+	// addresses of the established connection.
+	HeaderFunc HeaderFunc
+}
+
+// Dial connects to the address on the named network and writes the proxy
+// protocol header.
+func (d *Dialer) Dial(network, address string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, address)
+}
+
+// DialContext connects to the address on the named network using the
+// provided context and writes the proxy protocol header. The context
+// deadline, if any, also applies to writing the header.
+func (d *Dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := d.Dialer
+	if dialer == nil {
+		dialer = &net.Dialer{}
+	}
+
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := d.writeHeader(ctx, conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+func (d *Dialer) writeHeader(ctx context.Context, conn net.Conn) error {
+	header := d.Header
+	if d.HeaderFunc != nil {
+		var err error
+		header, err = d.HeaderFunc(ctx, conn.LocalAddr(), conn.RemoteAddr())
+		if err != nil {
+			return err
+		}
+	}
+	if header == nil {
+		return ErrNoHeaderToWrite
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetWriteDeadline(deadline); err != nil {
+			return err
+		}
+		defer conn.SetWriteDeadline(time.Time{})
+	}
+
+	_, err := header.WriteTo(conn)
+	return err
+}
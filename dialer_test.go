@@ -0,0 +1,201 @@
+package proxyproto
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestDialerWritesHeaderTemplate(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l}
+	defer pl.Close()
+
+	for _, version := range []byte{1, 2} {
+		dialer := &Dialer{
+			Header: &Header{
+				Version:           version,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
+			},
+		}
+
+		go func() {
+			conn, err := dialer.Dial("tcp", pl.Addr().String())
+			if err != nil {
+				t.Errorf("err: %v", err)
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte("ping"))
+		}()
+
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		recv := make([]byte, 4)
+		if _, err = conn.Read(recv); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if !bytes.Equal(recv, []byte("ping")) {
+			t.Fatalf("bad: %v", recv)
+		}
+
+		if header := conn.(*Conn).ProxyHeader(); !header.EqualsTo(dialer.Header) {
+			t.Fatalf("expected %#v, actual %#v", dialer.Header, header)
+		}
+		conn.Close()
+	}
+}
+
+func TestDialerWritesHeaderFromFunc(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l}
+	defer pl.Close()
+
+	dialer := &Dialer{
+		HeaderFunc: func(ctx context.Context, source, destination net.Addr) (*Header, error) {
+			return HeaderProxyFromAddrs(2, source, destination), nil
+		},
+	}
+
+	localAddr := make(chan net.Addr, 1)
+	go func() {
+		conn, err := dialer.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			t.Errorf("err: %v", err)
+			localAddr <- nil
+			return
+		}
+		defer conn.Close()
+		localAddr <- conn.LocalAddr()
+		conn.Write([]byte("ping"))
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	expected := <-localAddr
+	if expected == nil {
+		t.FailNow()
+	}
+	if actual := conn.RemoteAddr(); actual.String() != expected.String() {
+		t.Fatalf("expected %v, actual %v", expected, actual)
+	}
+}
+
+type clientAddrKey struct{}
+
+func TestDialerPassesContextToHeaderFunc(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l}
+	defer pl.Close()
+
+	// A single dialer forwards the connections of several clients
+	dialer := &Dialer{
+		HeaderFunc: func(ctx context.Context, source, destination net.Addr) (*Header, error) {
+			client, ok := ctx.Value(clientAddrKey{}).(net.Addr)
+			if !ok {
+				return nil, errors.New("no client address in context")
+			}
+			return HeaderProxyFromAddrs(2, client, destination), nil
+		},
+	}
+
+	for _, client := range []string{"10.1.1.1:1000", "10.3.3.3:3000"} {
+		clientAddr, err := net.ResolveTCPAddr("tcp", client)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		go func() {
+			ctx := context.WithValue(context.Background(), clientAddrKey{}, clientAddr)
+			conn, err := dialer.DialContext(ctx, "tcp", pl.Addr().String())
+			if err != nil {
+				t.Errorf("err: %v", err)
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte("ping"))
+		}()
+
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		recv := make([]byte, 4)
+		if _, err = conn.Read(recv); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		if actual := conn.RemoteAddr(); actual.String() != client {
+			t.Fatalf("expected %v, actual %v", client, actual)
+		}
+		if actual := conn.LocalAddr(); actual.String() != pl.Addr().String() {
+			t.Fatalf("expected %v, actual %v", pl.Addr(), actual)
+		}
+		conn.Close()
+	}
+}
+
+func TestDialerReturnsHeaderFuncError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+
+	expectedErr := errors.New("failure")
+	dialer := &Dialer{
+		HeaderFunc: func(ctx context.Context, source, destination net.Addr) (*Header, error) {
+			return nil, expectedErr
+		},
+	}
+
+	conn, err := dialer.Dial("tcp", l.Addr().String())
+	if err != expectedErr {
+		t.Fatalf("expected %v, actual %v", expectedErr, err)
+	}
+	if conn != nil {
+		t.Fatalf("expected no connection, got %v", conn)
+	}
+}
+
+func TestDialerWithoutHeaderFails(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer l.Close()
+
+	if _, err := (&Dialer{}).Dial("tcp", l.Addr().String()); err != ErrNoHeaderToWrite {
+		t.Fatalf("expected %v, actual %v", ErrNoHeaderToWrite, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"bufio"
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"net"
 	"time"
@@ -29,34 +30,182 @@ var (
 	ErrInvalidAddress                       = errors.New("Invalid address")
 	ErrInvalidPortNumber                    = errors.New("Invalid port number")
 	ErrSuperfluousProxyHeader               = errors.New("Upstream connection sent PROXY header but isn't allowed to send one")
+	ErrReadHeaderTimeout                    = errors.New("Timed out reading proxy protocol header")
+	ErrNeedMoreData                         = errors.New("Need more data to parse proxy protocol header")
+	ErrVersion1HeaderTooLong                = errors.New("Version 1 header must be 107 bytes or less")
+	ErrLineMustEndWithCrlf                  = errors.New("Version 1 header is invalid, must end with \\r\\n")
+	ErrInvalidSeparator                     = errors.New("Version 1 header fields must be separated by a single space")
+	ErrInvalidTokenCount                    = errors.New("Version 1 header has an invalid number of fields")
+	ErrHeaderTooLarge                       = errors.New("Proxy protocol header exceeds the maximum size")
+	ErrTooManyTLVs                          = errors.New("Proxy protocol header exceeds the maximum number of TLVs")
 )
 
+// ParseError describes why a proxy protocol header couldn't be parsed. Err
+// is one of the errors above, which errors.Is matches through ParseError.
+type ParseError struct {
+	// Version is the version of the header, 1 or 2.
+	Version byte
+	// Field is the name of the field which couldn't be parsed.
+	Field string
+	// Offset is the offset of the field from the beginning of the header.
+	Offset int
+	// Err is the reason why the field couldn't be parsed.
+	Err error
+}
+
+func newParseError(version byte, field string, offset int, err error) *ParseError {
+	return &ParseError{
+		Version: version,
+		Field:   field,
+		Offset:  offset,
+		Err:     err,
+	}
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v (v%d header, %s at offset %d)", e.Err, e.Version, e.Field, e.Offset)
+}
+
+// Unwrap returns the reason why the header couldn't be parsed.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
 // Header is the placeholder for proxy protocol header.
 type Header struct {
-	Version            byte
-	Command            ProtocolVersionAndCommand
-	TransportProtocol  AddressFamilyAndProtocol
-	SourceAddress      net.IP
-	DestinationAddress net.IP
-	SourcePort         uint16
-	DestinationPort    uint16
-	rawTLVs            []byte
+	Version           byte
+	Command           ProtocolVersionAndCommand
+	TransportProtocol AddressFamilyAndProtocol
+	SourceAddr        net.Addr
+	DestinationAddr   net.Addr
+	rawTLVs           []byte
+	// rawAddresses is the address block of a received v2 header
+	rawAddresses []byte
+}
+
+// HeaderProxyFromAddrs creates a new PROXY header from a source and a
+// destination address. The transport protocol is derived from the address
+// types (*net.TCPAddr, *net.UDPAddr or *net.UnixAddr) and IP families, where
+// IPv4-mapped IPv6 addresses count as IPv4. If the addresses disagree on
+// either, a LOCAL header with an UNSPEC transport protocol is returned.
+func HeaderProxyFromAddrs(version byte, sourceAddr, destAddr net.Addr) *Header {
+	header := &Header{
+		Version:           version,
+		Command:           LOCAL,
+		TransportProtocol: UNSPEC,
+	}
+
+	switch sourceAddr := sourceAddr.(type) {
+	case *net.TCPAddr:
+		destAddr, ok := destAddr.(*net.TCPAddr)
+		if !ok {
+			return header
+		}
+		header.TransportProtocol = ipTransportProtocol(sourceAddr.IP, destAddr.IP, TCPv4, TCPv6)
+	case *net.UDPAddr:
+		destAddr, ok := destAddr.(*net.UDPAddr)
+		if !ok {
+			return header
+		}
+		header.TransportProtocol = ipTransportProtocol(sourceAddr.IP, destAddr.IP, UDPv4, UDPv6)
+	case *net.UnixAddr:
+		destAddr, ok := destAddr.(*net.UnixAddr)
+		if !ok || sourceAddr.Net != destAddr.Net {
+			return header
+		}
+		switch sourceAddr.Net {
+		case "unix":
+			header.TransportProtocol = UnixStream
+		case "unixgram":
+			header.TransportProtocol = UnixDatagram
+		}
+	}
+
+	if header.TransportProtocol != UNSPEC {
+		header.Command = PROXY
+		header.SourceAddr = sourceAddr
+		header.DestinationAddr = destAddr
+	}
+
+	return header
+}
+
+// ipTransportProtocol returns protocolV4 if both IPs are IPv4 (or IPv4-mapped
+// IPv6), protocolV6 if both are IPv6, and UNSPEC otherwise.
+func ipTransportProtocol(sourceIP, destIP net.IP, protocolV4, protocolV6 AddressFamilyAndProtocol) AddressFamilyAndProtocol {
+	sourceIP4, destIP4 := sourceIP.To4(), destIP.To4()
+	if sourceIP4 != nil && destIP4 != nil {
+		return protocolV4
+	}
+	if sourceIP4 == nil && destIP4 == nil && len(sourceIP) == net.IPv6len && len(destIP) == net.IPv6len {
+		return protocolV6
+	}
+	return UNSPEC
 }
 
 // RemoteAddr returns the address of the remote endpoint of the connection.
 func (header *Header) RemoteAddr() net.Addr {
-	return &net.TCPAddr{
-		IP:   header.SourceAddress,
-		Port: int(header.SourcePort),
-	}
+	return header.SourceAddr
 }
 
 // LocalAddr returns the address of the local endpoint of the connection.
 func (header *Header) LocalAddr() net.Addr {
-	return &net.TCPAddr{
-		IP:   header.DestinationAddress,
-		Port: int(header.DestinationPort),
+	return header.DestinationAddr
+}
+
+// TCPAddrs returns the TCP source and destination addresses of the header,
+// and false if they aren't TCP addresses.
+func (header *Header) TCPAddrs() (sourceAddr, destAddr *net.TCPAddr, ok bool) {
+	if !header.TransportProtocol.IsStream() || header.TransportProtocol.IsUnix() {
+		return nil, nil, false
+	}
+	sourceAddr, sourceOK := header.SourceAddr.(*net.TCPAddr)
+	destAddr, destOK := header.DestinationAddr.(*net.TCPAddr)
+	return sourceAddr, destAddr, sourceOK && destOK
+}
+
+// UDPAddrs returns the UDP source and destination addresses of the header,
+// and false if they aren't UDP addresses.
+func (header *Header) UDPAddrs() (sourceAddr, destAddr *net.UDPAddr, ok bool) {
+	if !header.TransportProtocol.IsDatagram() || header.TransportProtocol.IsUnix() {
+		return nil, nil, false
+	}
+	sourceAddr, sourceOK := header.SourceAddr.(*net.UDPAddr)
+	destAddr, destOK := header.DestinationAddr.(*net.UDPAddr)
+	return sourceAddr, destAddr, sourceOK && destOK
+}
+
+// UnixAddrs returns the Unix source and destination addresses of the header,
+// and false if they aren't Unix addresses.
+func (header *Header) UnixAddrs() (sourceAddr, destAddr *net.UnixAddr, ok bool) {
+	if !header.TransportProtocol.IsUnix() {
+		return nil, nil, false
+	}
+	sourceAddr, sourceOK := header.SourceAddr.(*net.UnixAddr)
+	destAddr, destOK := header.DestinationAddr.(*net.UnixAddr)
+	return sourceAddr, destAddr, sourceOK && destOK
+}
+
+// IPs returns the source and destination IPs of a TCP or UDP header, and
+// false otherwise.
+func (header *Header) IPs() (sourceIP, destIP net.IP, ok bool) {
+	if sourceAddr, destAddr, ok := header.TCPAddrs(); ok {
+		return sourceAddr.IP, destAddr.IP, true
+	} else if sourceAddr, destAddr, ok := header.UDPAddrs(); ok {
+		return sourceAddr.IP, destAddr.IP, true
 	}
+	return nil, nil, false
+}
+
+// Ports returns the source and destination ports of a TCP or UDP header, and
+// false otherwise.
+func (header *Header) Ports() (sourcePort, destPort int, ok bool) {
+	if sourceAddr, destAddr, ok := header.TCPAddrs(); ok {
+		return sourceAddr.Port, destAddr.Port, true
+	} else if sourceAddr, destAddr, ok := header.UDPAddrs(); ok {
+		return sourceAddr.Port, destAddr.Port, true
+	}
+	return 0, 0, false
 }
 
 // EqualTo returns true if headers are equivalent, false otherwise.
@@ -79,10 +228,15 @@ func (header *Header) EqualsTo(otherHeader *Header) bool {
 	}
 	return header.Version == otherHeader.Version &&
 		header.TransportProtocol == otherHeader.TransportProtocol &&
-		header.SourceAddress.String() == otherHeader.SourceAddress.String() &&
-		header.DestinationAddress.String() == otherHeader.DestinationAddress.String() &&
-		header.SourcePort == otherHeader.SourcePort &&
-		header.DestinationPort == otherHeader.DestinationPort
+		equalAddrs(header.SourceAddr, otherHeader.SourceAddr) &&
+		equalAddrs(header.DestinationAddr, otherHeader.DestinationAddr)
+}
+
+func equalAddrs(addr, otherAddr net.Addr) bool {
+	if addr == nil || otherAddr == nil {
+		return addr == otherAddr
+	}
+	return addr.Network() == otherAddr.Network() && addr.String() == otherAddr.String()
 }
 
 // WriteTo renders a proxy protocol header in a format and writes it to an io.Writer.
@@ -96,6 +250,8 @@ func (header *Header) WriteTo(w io.Writer) (int64, error) {
 }
 
 // Format renders a proxy protocol header in a format to write over the wire.
+// If a v2 header carries a PP2_TYPE_CRC32C TLV with a 4-byte value, the
+// checksum of the header is computed and written in it.
 func (header *Header) Format() ([]byte, error) {
 	switch header.Version {
 	case 1:
@@ -112,6 +268,31 @@ func (header *Header) TLVs() ([]TLV, error) {
 	return SplitTLVs(header.rawTLVs)
 }
 
+// SetTLVs sets the TLVs stored in this header. This method replaces any
+// previous TLV. TLVs are only written for v2 of the protocol.
+func (header *Header) SetTLVs(tlvs []TLV) error {
+	raw, err := JoinTLVs(tlvs)
+	if err != nil {
+		return err
+	}
+	header.rawTLVs = raw
+	return nil
+}
+
+// ReadOptions limits the resources spent reading a header. The zero value
+// sets no limit besides the ones of the specification.
+type ReadOptions struct {
+	// MaxHeaderSize, if positive, is the maximum length of a v2 header,
+	// signature included. Longer headers are rejected with ErrHeaderTooLarge
+	// as soon as their length is read. v1 headers are always limited to 107
+	// bytes.
+	MaxHeaderSize int
+	// MaxTLVs, if positive, is the maximum number of TLVs of a v2 header.
+	// Headers carrying more are rejected with ErrTooManyTLVs before the TLVs
+	// are copied.
+	MaxTLVs int
+}
+
 // Read identifies the proxy protocol version and reads the remaining of
 // the header, accordingly.
 //
@@ -119,23 +300,106 @@ func (header *Header) TLVs() ([]TLV, error) {
 // and is safe for reading outside of this code.
 //
 // If proxy protocol header signature is present but an error is raised while processing
-// the remaining header, assume the reader buffer to be in a corrupt state.
+// the remaining header, assume the reader buffer to be in a corrupt state. Such errors
+// are returned as a *ParseError.
 // Also, this operation will block until enough bytes are available for peeking.
 func Read(reader *bufio.Reader) (*Header, error) {
+	return ReadWithOptions(reader, ReadOptions{})
+}
+
+// ReadWithOptions acts as Read, within the limits set by opts.
+func ReadWithOptions(reader *bufio.Reader, opts ReadOptions) (*Header, error) {
+	version, err := peekVersion(reader)
+	if err != nil {
+		return nil, err
+	}
+	if version == 1 {
+		return parseVersion1(reader)
+	}
+	return parseVersion2(reader, opts)
+}
+
+// peekVersion returns the proxy protocol version whose signature starts the
+// reader, or ErrNoProxyProtocol. It only blocks until enough bytes arrive to
+// tell, so that it returns early for short non-PROXYed packets.
+func peekVersion(reader *bufio.Reader) (byte, error) {
 	// In order to improve speed for small non-PROXYed packets, take a peek at the first byte alone.
-	if b1, err := reader.Peek(1); err == nil && (bytes.Equal(b1[:1], SIGV1[:1]) || bytes.Equal(b1[:1], SIGV2[:1])) {
-		if signature, err := reader.Peek(5); err == nil && bytes.Equal(signature[:5], SIGV1) {
-			return parseVersion1(reader)
-		} else if signature, err := reader.Peek(12); err == nil && bytes.Equal(signature[:12], SIGV2) {
-			return parseVersion2(reader)
+	for _, n := range [...]int{1, len(SIGV1), len(SIGV2)} {
+		b, err := reader.Peek(n)
+		switch version, sniffErr := sniffVersion(b); {
+		case version != 0:
+			return version, nil
+		case sniffErr != ErrNeedMoreData || err != nil:
+			return 0, ErrNoProxyProtocol
 		}
 	}
 
-	return nil, ErrNoProxyProtocol
+	return 0, ErrNoProxyProtocol
+}
+
+// Parse identifies the proxy protocol version and parses the header at the
+// beginning of b, returning it along with the number of bytes it spans.
+// Unlike Read, it doesn't block: if b only holds the beginning of a header,
+// ErrNeedMoreData is returned and Parse should be called again once more
+// bytes are available. If b doesn't start with a proxy protocol signature,
+// ErrNoProxyProtocol is returned. Other errors are returned as a *ParseError.
+func Parse(b []byte) (*Header, int, error) {
+	version, err := sniffVersion(b)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if version == 1 {
+		end := bytes.IndexByte(b, '\n')
+		if end < 0 || end >= maxVersion1Length {
+			if len(b) < maxVersion1Length {
+				return nil, 0, ErrNeedMoreData
+			}
+			return nil, 0, newParseError(1, "line", maxVersion1Length, ErrVersion1HeaderTooLong)
+		}
+		header, err := parseVersion1Line(string(b[:end+1]))
+		if err != nil {
+			return nil, 0, err
+		}
+		return header, end + 1, nil
+	}
+
+	command, transportProtocol, length, err := parseVersion2Preamble(b)
+	if errors.Is(err, ErrCantReadProtocolVersionAndCommand) || errors.Is(err, ErrCantReadAddressFamilyAndProtocol) || errors.Is(err, ErrCantReadLength) {
+		return nil, 0, ErrNeedMoreData
+	} else if err != nil {
+		return nil, 0, err
+	}
+
+	n := lengthV2Preamble + int(length)
+	if len(b) < n {
+		return nil, 0, ErrNeedMoreData
+	}
+	return parseVersion2Payload(command, transportProtocol, b[lengthV2Preamble:n]), n, nil
+}
+
+// sniffVersion returns the proxy protocol version whose signature starts b.
+// It returns ErrNeedMoreData if b is too short to tell, and
+// ErrNoProxyProtocol if b doesn't start with a signature.
+func sniffVersion(b []byte) (byte, error) {
+	if len(b) >= len(SIGV1) && bytes.Equal(b[:len(SIGV1)], SIGV1) {
+		return 1, nil
+	}
+	if len(b) >= len(SIGV2) && bytes.Equal(b[:len(SIGV2)], SIGV2) {
+		return 2, nil
+	}
+	if bytes.HasPrefix(SIGV1, b) || bytes.HasPrefix(SIGV2, b) {
+		return 0, ErrNeedMoreData
+	}
+	return 0, ErrNoProxyProtocol
 }
 
 // ReadTimeout acts as Read but takes a timeout. If that timeout is reached, it's assumed
 // there's no proxy protocol header.
+//
+// On timeout, the goroutine reading the header is left blocked until the reader returns.
+// When reading from a connection, prefer Listener.ReadHeaderTimeout or the
+// SetReadHeaderTimeout option of NewConn, which rely on read deadlines instead.
 func ReadTimeout(reader *bufio.Reader, timeout time.Duration) (*Header, error) {
 	type header struct {
 		h *Header
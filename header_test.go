@@ -3,6 +3,7 @@ package proxyproto
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"net"
 	"testing"
 	"time"
@@ -48,56 +49,76 @@ func TestEqualsTo(t *testing.T) {
 	}{
 		{
 			&Header{
-				Version:            1,
-				Command:            PROXY,
-				TransportProtocol:  TCPv4,
-				SourceAddress:      net.ParseIP("10.1.1.1"),
-				SourcePort:         1000,
-				DestinationAddress: net.ParseIP("20.2.2.2"),
-				DestinationPort:    2000,
+				Version:           1,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
 			},
 			nil,
 			false,
 		},
 		{
 			&Header{
-				Version:            1,
-				Command:            PROXY,
-				TransportProtocol:  TCPv4,
-				SourceAddress:      net.ParseIP("10.1.1.1"),
-				SourcePort:         1000,
-				DestinationAddress: net.ParseIP("20.2.2.2"),
-				DestinationPort:    2000,
+				Version:           1,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
 			},
 			&Header{
-				Version:            2,
-				Command:            PROXY,
-				TransportProtocol:  TCPv4,
-				SourceAddress:      net.ParseIP("10.1.1.1"),
-				SourcePort:         1000,
-				DestinationAddress: net.ParseIP("20.2.2.2"),
-				DestinationPort:    2000,
+				Version:           2,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
 			},
 			false,
 		},
 		{
 			&Header{
-				Version:            1,
-				Command:            PROXY,
-				TransportProtocol:  TCPv4,
-				SourceAddress:      net.ParseIP("10.1.1.1"),
-				SourcePort:         1000,
-				DestinationAddress: net.ParseIP("20.2.2.2"),
-				DestinationPort:    2000,
+				Version:           1,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
 			},
 			&Header{
-				Version:            1,
-				Command:            PROXY,
-				TransportProtocol:  TCPv4,
-				SourceAddress:      net.ParseIP("10.1.1.1"),
-				SourcePort:         1000,
-				DestinationAddress: net.ParseIP("20.2.2.2"),
-				DestinationPort:    2000,
+				Version:           1,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
 			},
 			true,
 		},
@@ -123,13 +144,17 @@ func TestLocalAddr(t *testing.T) {
 	}{
 		{
 			&Header{
-				Version:            1,
-				Command:            PROXY,
-				TransportProtocol:  TCPv4,
-				SourceAddress:      net.ParseIP("10.1.1.1"),
-				SourcePort:         1000,
-				DestinationAddress: net.ParseIP("20.2.2.2"),
-				DestinationPort:    2000,
+				Version:           1,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
 			},
 			&net.TCPAddr{
 				IP:   net.ParseIP("20.2.2.2"),
@@ -139,13 +164,17 @@ func TestLocalAddr(t *testing.T) {
 		},
 		{
 			&Header{
-				Version:            1,
-				Command:            PROXY,
-				TransportProtocol:  TCPv4,
-				SourceAddress:      net.ParseIP("10.1.1.1"),
-				SourcePort:         1000,
-				DestinationAddress: net.ParseIP("20.2.2.2"),
-				DestinationPort:    2000,
+				Version:           1,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
 			},
 			&net.TCPAddr{
 				IP:   net.ParseIP("10.1.1.1"),
@@ -171,13 +200,17 @@ func TestRemoteAddr(t *testing.T) {
 	}{
 		{
 			&Header{
-				Version:            1,
-				Command:            PROXY,
-				TransportProtocol:  TCPv4,
-				SourceAddress:      net.ParseIP("10.1.1.1"),
-				SourcePort:         1000,
-				DestinationAddress: net.ParseIP("20.2.2.2"),
-				DestinationPort:    2000,
+				Version:           1,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
 			},
 			&net.TCPAddr{
 				IP:   net.ParseIP("20.2.2.2"),
@@ -187,13 +220,17 @@ func TestRemoteAddr(t *testing.T) {
 		},
 		{
 			&Header{
-				Version:            1,
-				Command:            PROXY,
-				TransportProtocol:  TCPv4,
-				SourceAddress:      net.ParseIP("10.1.1.1"),
-				SourcePort:         1000,
-				DestinationAddress: net.ParseIP("20.2.2.2"),
-				DestinationPort:    2000,
+				Version:           1,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
 			},
 			&net.TCPAddr{
 				IP:   net.ParseIP("10.1.1.1"),
@@ -215,13 +252,17 @@ func TestWriteTo(t *testing.T) {
 	var buf bytes.Buffer
 
 	validHeader := &Header{
-		Version:            1,
-		Command:            PROXY,
-		TransportProtocol:  TCPv4,
-		SourceAddress:      net.ParseIP("10.1.1.1"),
-		SourcePort:         1000,
-		DestinationAddress: net.ParseIP("20.2.2.2"),
-		DestinationPort:    2000,
+		Version:           1,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
 	}
 
 	if _, err := validHeader.WriteTo(&buf); err != nil {
@@ -229,10 +270,14 @@ func TestWriteTo(t *testing.T) {
 	}
 
 	invalidHeader := &Header{
-		SourceAddress:      net.ParseIP("10.1.1.1"),
-		SourcePort:         1000,
-		DestinationAddress: net.ParseIP("20.2.2.2"),
-		DestinationPort:    2000,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
 	}
 
 	if _, err := invalidHeader.WriteTo(&buf); err == nil {
@@ -242,13 +287,17 @@ func TestWriteTo(t *testing.T) {
 
 func TestFormat(t *testing.T) {
 	validHeader := &Header{
-		Version:            1,
-		Command:            PROXY,
-		TransportProtocol:  TCPv4,
-		SourceAddress:      net.ParseIP("10.1.1.1"),
-		SourcePort:         1000,
-		DestinationAddress: net.ParseIP("20.2.2.2"),
-		DestinationPort:    2000,
+		Version:           1,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
 	}
 
 	if _, err := validHeader.Format(); err != nil {
@@ -256,13 +305,17 @@ func TestFormat(t *testing.T) {
 	}
 
 	invalidHeader := &Header{
-		Version:            3,
-		Command:            PROXY,
-		TransportProtocol:  TCPv4,
-		SourceAddress:      net.ParseIP("10.1.1.1"),
-		SourcePort:         1000,
-		DestinationAddress: net.ParseIP("20.2.2.2"),
-		DestinationPort:    2000,
+		Version:           3,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
 	}
 
 	if _, err := invalidHeader.Format(); err == nil {
@@ -273,3 +326,271 @@ func TestFormat(t *testing.T) {
 		}
 	}
 }
+
+func TestHeaderProxyFromAddrs(t *testing.T) {
+	unspec := &Header{
+		Version:           2,
+		Command:           LOCAL,
+		TransportProtocol: UNSPEC,
+	}
+
+	tests := []struct {
+		name                 string
+		version              byte
+		sourceAddr, destAddr net.Addr
+		expected             *Header
+	}{
+		{
+			name:       "TCPv4",
+			version:    2,
+			sourceAddr: &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+			destAddr:   &net.TCPAddr{IP: net.ParseIP("20.2.2.2"), Port: 2000},
+			expected: &Header{
+				Version:           2,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
+			},
+		},
+		{
+			name:       "TCPv4 with IPv4-mapped IPv6",
+			version:    1,
+			sourceAddr: &net.TCPAddr{IP: net.ParseIP("::ffff:10.1.1.1"), Port: 1000},
+			destAddr:   &net.TCPAddr{IP: net.ParseIP("20.2.2.2").To4(), Port: 2000},
+			expected: &Header{
+				Version:           1,
+				Command:           PROXY,
+				TransportProtocol: TCPv4,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
+			},
+		},
+		{
+			name:       "TCPv6",
+			version:    2,
+			sourceAddr: &net.TCPAddr{IP: net.ParseIP("fde7::372"), Port: 1000},
+			destAddr:   &net.TCPAddr{IP: net.ParseIP("fde7::1"), Port: 2000},
+			expected: &Header{
+				Version:           2,
+				Command:           PROXY,
+				TransportProtocol: TCPv6,
+				SourceAddr: &net.TCPAddr{
+					IP:   net.ParseIP("fde7::372"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.TCPAddr{
+					IP:   net.ParseIP("fde7::1"),
+					Port: 2000,
+				},
+			},
+		},
+		{
+			name:       "UDPv4",
+			version:    2,
+			sourceAddr: &net.UDPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+			destAddr:   &net.UDPAddr{IP: net.ParseIP("20.2.2.2"), Port: 2000},
+			expected: &Header{
+				Version:           2,
+				Command:           PROXY,
+				TransportProtocol: UDPv4,
+				SourceAddr: &net.UDPAddr{
+					IP:   net.ParseIP("10.1.1.1"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.UDPAddr{
+					IP:   net.ParseIP("20.2.2.2"),
+					Port: 2000,
+				},
+			},
+		},
+		{
+			name:       "UDPv6",
+			version:    2,
+			sourceAddr: &net.UDPAddr{IP: net.ParseIP("fde7::372"), Port: 1000},
+			destAddr:   &net.UDPAddr{IP: net.ParseIP("fde7::1"), Port: 2000},
+			expected: &Header{
+				Version:           2,
+				Command:           PROXY,
+				TransportProtocol: UDPv6,
+				SourceAddr: &net.UDPAddr{
+					IP:   net.ParseIP("fde7::372"),
+					Port: 1000,
+				},
+				DestinationAddr: &net.UDPAddr{
+					IP:   net.ParseIP("fde7::1"),
+					Port: 2000,
+				},
+			},
+		},
+		{
+			name:       "mixed IP families",
+			version:    2,
+			sourceAddr: &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+			destAddr:   &net.TCPAddr{IP: net.ParseIP("fde7::1"), Port: 2000},
+			expected:   unspec,
+		},
+		{
+			name:       "mixed transports",
+			version:    2,
+			sourceAddr: &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+			destAddr:   &net.UDPAddr{IP: net.ParseIP("20.2.2.2"), Port: 2000},
+			expected:   unspec,
+		},
+		{
+			name:       "missing address",
+			version:    2,
+			sourceAddr: nil,
+			destAddr:   &net.TCPAddr{IP: net.ParseIP("20.2.2.2"), Port: 2000},
+			expected:   unspec,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := HeaderProxyFromAddrs(tt.version, tt.sourceAddr, tt.destAddr)
+			if header.Command != tt.expected.Command || header.TransportProtocol != tt.expected.TransportProtocol {
+				t.Fatalf("expected %#v, actual %#v", tt.expected, header)
+			}
+			if !header.EqualsTo(tt.expected) {
+				t.Fatalf("expected %#v, actual %#v", tt.expected, header)
+			}
+		})
+	}
+}
+
+func TestHeaderProxyFromUnixAddrs(t *testing.T) {
+	tests := []struct {
+		network  string
+		expected AddressFamilyAndProtocol
+	}{
+		{"unix", UnixStream},
+		{"unixgram", UnixDatagram},
+	}
+
+	for _, tt := range tests {
+		header := HeaderProxyFromAddrs(2,
+			&net.UnixAddr{Net: tt.network, Name: "src"},
+			&net.UnixAddr{Net: tt.network, Name: "dst"})
+		if header.Command != PROXY || header.TransportProtocol != tt.expected {
+			t.Fatalf("expected %x, actual %#v", tt.expected, header)
+		}
+	}
+
+	header := HeaderProxyFromAddrs(2,
+		&net.UnixAddr{Net: "unix", Name: "src"},
+		&net.UnixAddr{Net: "unixgram", Name: "dst"})
+	if header.Command != LOCAL || header.TransportProtocol != UNSPEC {
+		t.Fatalf("expected LOCAL UNSPEC header, actual %#v", header)
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n")},
+		{"v2 IPv4", append(append(SIGV2, byte(PROXY), byte(TCPv4)), fixtureIPv4V2...)},
+		{"v2 IPv6 with TLVs", append(append(SIGV2, byte(PROXY), byte(TCPv6)), fixtureIPv6V2TLV...)},
+		{"v2 Unix", append(append(SIGV2, byte(PROXY), byte(UnixStream)), fixtureUnixV2...)},
+	}
+
+	for _, tt := range tests {
+		expected, err := Read(newBufioReader(tt.raw))
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+
+		header, n, err := Parse(append(append([]byte(nil), tt.raw...), arbitraryTailBytes...))
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if n != len(tt.raw) {
+			t.Fatalf("%s: expected %d bytes consumed, actual %d", tt.name, len(tt.raw), n)
+		}
+		if !header.EqualsTo(expected) {
+			t.Fatalf("%s: expected %#v, actual %#v", tt.name, expected, header)
+		}
+
+		// Every truncated prefix of a valid header asks for more data
+		for i := 0; i < len(tt.raw); i++ {
+			if _, n, err := Parse(tt.raw[:i]); err != ErrNeedMoreData || n != 0 {
+				t.Fatalf("%s: expected %v for %d bytes, actual %v (%d)", tt.name, ErrNeedMoreData, i, err, n)
+			}
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      []byte
+		expected error
+	}{
+		{"no signature", []byte("GET / HTTP/1.1\r\n"), ErrNoProxyProtocol},
+		{"partial signature mismatch", []byte("PRO\r"), ErrNoProxyProtocol},
+		{"v1 line too long", append([]byte("PROXY TCP4 "), bytes.Repeat([]byte{'1'}, 110)...), ErrVersion1HeaderTooLong},
+		{"v1 invalid line", []byte("PROXY TCP4 10.1.1.1\r\n"), ErrInvalidTokenCount},
+		{"v2 unsupported command", append(SIGV2, invalidRune), ErrUnsupportedProtocolVersionAndCommand},
+		{"v2 unsupported transport protocol", append(SIGV2, byte(PROXY), invalidRune), ErrUnsupportedAddressFamilyAndProtocol},
+		{"v2 invalid length", append(append(SIGV2, byte(PROXY), byte(TCPv6)), lengthV4Bytes...), ErrInvalidLength},
+	}
+
+	for _, tt := range tests {
+		if _, n, err := Parse(tt.raw); !errors.Is(err, tt.expected) || n != 0 {
+			t.Fatalf("%s: expected %v, actual %v (%d)", tt.name, tt.expected, err, n)
+		}
+	}
+}
+
+func TestParseErrorDescribesTheField(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      []byte
+		expected ParseError
+	}{
+		{
+			"v1 source port",
+			[]byte("PROXY TCP4 10.1.1.1 20.2.2.2 01000 2000\r\n"),
+			ParseError{Version: 1, Field: "source port", Offset: 29, Err: ErrInvalidPortNumber},
+		},
+		{
+			"v1 separator",
+			[]byte("PROXY TCP4 10.1.1.1  20.2.2.2 1000 2000\r\n"),
+			ParseError{Version: 1, Field: "separator", Offset: 19, Err: ErrInvalidSeparator},
+		},
+		{
+			"v2 length",
+			append(append(SIGV2, byte(PROXY), byte(TCPv6)), lengthV4Bytes...),
+			ParseError{Version: 2, Field: "length", Offset: 14, Err: ErrInvalidLength},
+		},
+	}
+
+	for _, tt := range tests {
+		_, err := Read(newBufioReader(tt.raw))
+
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) {
+			t.Fatalf("%s: expected a *ParseError, actual %#v", tt.name, err)
+		}
+		if *parseErr != tt.expected {
+			t.Fatalf("%s: expected %+v, actual %+v", tt.name, tt.expected, *parseErr)
+		}
+		if !errors.Is(err, tt.expected.Err) {
+			t.Fatalf("%s: expected errors.Is to match %v", tt.name, tt.expected.Err)
+		}
+	}
+}
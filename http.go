@@ -0,0 +1,29 @@
+package proxyproto
+
+import (
+	"context"
+	"net"
+)
+
+type connContextKey struct{}
+
+// ConnContext can be used as the ConnContext hook of an http.Server serving
+// a Listener, or a listener returned by NewTLSListener, so that handlers can
+// retrieve the proxy protocol header of the connection with
+// HeaderFromContext.
+//
+// The connection is stored instead of its header, because http.Server calls
+// ConnContext before starting to serve the connection: the header is only
+// read once HeaderFromContext is called, which doesn't block the server from
+// accepting other connections.
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+// HeaderFromContext returns the proxy protocol header of the connection
+// stored in ctx by ConnContext, e.g. the context of an http.Request. It
+// returns nil if there is none, see HeaderFromConn.
+func HeaderFromContext(ctx context.Context) *Header {
+	conn, _ := ctx.Value(connContextKey{}).(net.Conn)
+	return HeaderFromConn(conn)
+}
@@ -0,0 +1,92 @@
+package proxyproto
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+)
+
+func TestHeaderFromContext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l}
+
+	server := &http.Server{
+		ConnContext: ConnContext,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			header := HeaderFromContext(r.Context())
+			if header == nil {
+				http.Error(w, "no proxy header", http.StatusBadRequest)
+				return
+			}
+			tlvs, err := header.TLVs()
+			if err != nil || len(tlvs) != 1 {
+				http.Error(w, "bad TLVs", http.StatusBadRequest)
+				return
+			}
+			io.WriteString(w, r.RemoteAddr+" "+string(tlvs[0].Value))
+		}),
+	}
+	go server.Serve(pl)
+	defer server.Close()
+
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
+	}
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_AUTHORITY, Length: 11, Value: []byte("example.com")}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: (&Dialer{Header: header}).DialContext,
+		},
+	}
+	defer client.CloseIdleConnections()
+
+	resp, err := client.Get("http://" + pl.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected status %d: %s", resp.StatusCode, body)
+	}
+	if string(body) != "10.1.1.1:1000 example.com" {
+		t.Fatalf("bad: %q", body)
+	}
+}
+
+func TestHeaderFromContextWithoutConn(t *testing.T) {
+	if h := HeaderFromContext(context.Background()); h != nil {
+		t.Fatalf("expected no header, actual %#v", h)
+	}
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	if h := HeaderFromContext(ConnContext(context.Background(), server)); h != nil {
+		t.Fatalf("expected no header, actual %#v", h)
+	}
+}
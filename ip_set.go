@@ -0,0 +1,104 @@
+package proxyproto
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strconv"
+)
+
+// ipSet is a set of IP addresses and IP ranges, stored in one binary prefix
+// trie per address family, so that lookups don't depend on the number of
+// entries. IPv4-mapped IPv6 addresses are stored and looked up as IPv4.
+type ipSet struct {
+	v4, v6 prefixNode
+}
+
+type prefixNode struct {
+	children [2]*prefixNode
+	// terminal is set if the prefix leading to the node is in the set
+	terminal bool
+}
+
+func (s *ipSet) insert(prefix netip.Prefix) {
+	addr, bits := prefix.Addr(), prefix.Bits()
+	if addr.Is4In6() && bits >= 96 {
+		addr, bits = addr.Unmap(), bits-96
+	}
+
+	node := &s.v6
+	if addr.Is4() {
+		node = &s.v4
+	}
+	b := addr.As16()
+	offset := 128 - addr.BitLen()
+	for i := 0; i < bits && !node.terminal; i++ {
+		bit := prefixBit(b, offset+i)
+		if node.children[bit] == nil {
+			node.children[bit] = new(prefixNode)
+		}
+		node = node.children[bit]
+	}
+	node.terminal = true
+	// Longer prefixes are covered by this one
+	node.children = [2]*prefixNode{}
+}
+
+func (s *ipSet) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	node := &s.v6
+	if addr.Is4() {
+		node = &s.v4
+	}
+	b := addr.As16()
+	offset := 128 - addr.BitLen()
+	for i := 0; node != nil; i++ {
+		if node.terminal {
+			return true
+		}
+		if i == addr.BitLen() {
+			return false
+		}
+		node = node.children[prefixBit(b, offset+i)]
+	}
+	return false
+}
+
+func (s *ipSet) containsIP(ip net.IP) bool {
+	addr, ok := netip.AddrFromSlice(ip)
+	return ok && s.contains(addr)
+}
+
+func prefixBit(b [16]byte, i int) byte {
+	return b[i/8] >> (7 - uint(i%8)) & 1
+}
+
+// addrPortFromAddr returns the IP address and port of a TCP or UDP address,
+// without formatting it as a string when possible.
+func addrPortFromAddr(addr net.Addr) (netip.AddrPort, error) {
+	var ip net.IP
+	var port int
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		ip, port = addr.IP, addr.Port
+	case *net.UDPAddr:
+		ip, port = addr.IP, addr.Port
+	case nil:
+		return netip.AddrPort{}, fmt.Errorf("invalid IP address")
+	default:
+		host, portString, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return netip.AddrPort{}, err
+		}
+		ip = net.ParseIP(host)
+		if port, err = strconv.Atoi(portString); err != nil {
+			return netip.AddrPort{}, fmt.Errorf("invalid IP address")
+		}
+	}
+
+	parsed, ok := netip.AddrFromSlice(ip)
+	if !ok || port < 0 || port > 65535 {
+		return netip.AddrPort{}, fmt.Errorf("invalid IP address")
+	}
+	return netip.AddrPortFrom(parsed.Unmap(), uint16(port)), nil
+}
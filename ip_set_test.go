@@ -0,0 +1,136 @@
+package proxyproto
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"net/netip"
+	"testing"
+)
+
+func TestIPSetContains(t *testing.T) {
+	set, err := parse([]string{"10.0.0.1", "10.1.0.0/16", "10.1.2.0/24", "::ffff:192.168.0.0/112", "2001:db8::/32", "fe80::1"})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var cases = []struct {
+		addr     string
+		expected bool
+	}{
+		{"10.0.0.1", true},
+		{"10.0.0.2", false},
+		{"10.1.255.255", true},
+		{"10.2.0.0", false},
+		{"::ffff:10.0.0.1", true},
+		{"192.168.1.1", true},
+		{"192.169.0.1", false},
+		{"2001:db8:1::1", true},
+		{"2001:db9::1", false},
+		{"fe80::1", true},
+		{"fe80::2", false},
+		{"::10.0.0.1", false},
+	}
+
+	for _, tc := range cases {
+		if contains := set.contains(netip.MustParseAddr(tc.addr)); contains != tc.expected {
+			t.Fatalf("%s: expected %v, got %v", tc.addr, tc.expected, contains)
+		}
+	}
+}
+
+func TestIPSetMatchesIPNet(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	allowed := randomIPv4Ranges(r, 1000)
+	set, err := parse(allowed)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	ipNets := make([]*net.IPNet, len(allowed))
+	for i, allowFrom := range allowed {
+		_, ipNets[i], _ = net.ParseCIDR(allowFrom)
+	}
+
+	for i := 0; i < 10000; i++ {
+		ip := net.IPv4(byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)))
+		expected := false
+		for _, ipNet := range ipNets {
+			if ipNet.Contains(ip) {
+				expected = true
+				break
+			}
+		}
+		if contains := set.containsIP(ip); contains != expected {
+			t.Fatalf("%s: expected %v, got %v", ip, expected, contains)
+		}
+	}
+}
+
+func TestAddrPortFromAddr(t *testing.T) {
+	var cases = []struct {
+		addr     net.Addr
+		expected string
+	}{
+		{&net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 1000}, "10.0.0.1:1000"},
+		{&net.UDPAddr{IP: net.ParseIP("::1"), Port: 2000}, "[::1]:2000"},
+		{&net.IPAddr{IP: net.ParseIP("10.0.0.1")}, ""},
+		{failingAddr{}, ""},
+		{nil, ""},
+	}
+
+	for _, tc := range cases {
+		addrPort, err := addrPortFromAddr(tc.addr)
+		if tc.expected == "" {
+			if err == nil {
+				t.Fatalf("%v: Expected error, got none", tc.addr)
+			}
+			continue
+		}
+		if err != nil || addrPort.String() != tc.expected {
+			t.Fatalf("%v: expected %s, got %v (%v)", tc.addr, tc.expected, addrPort, err)
+		}
+	}
+}
+
+func randomIPv4Ranges(r *rand.Rand, n int) []string {
+	allowed := make([]string, n)
+	for i := range allowed {
+		allowed[i] = fmt.Sprintf("%d.%d.%d.0/%d", r.Intn(256), r.Intn(256), r.Intn(256), 16+r.Intn(9))
+	}
+	return allowed
+}
+
+func BenchmarkWhitelistPolicy10k(b *testing.B) {
+	r := rand.New(rand.NewSource(1))
+	allowed := randomIPv4Ranges(r, 10000)
+	policy := MustStrictWhiteListPolicy(allowed)
+
+	upstreams := make([]net.Addr, 1024)
+	for i := range upstreams {
+		upstreams[i] = &net.TCPAddr{
+			IP:   net.IPv4(byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256)), byte(r.Intn(256))),
+			Port: 1000 + i,
+		}
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := policy(upstreams[i%len(upstreams)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParse10k(b *testing.B) {
+	allowed := randomIPv4Ranges(rand.New(rand.NewSource(1)), 10000)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := parse(allowed); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
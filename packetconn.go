@@ -0,0 +1,142 @@
+package proxyproto
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+// PacketConn is used to wrap an underlying packet connection, whose
+// datagrams may each start with a version 2 proxy protocol header, as sent
+// e.g. by UDP load balancers. If a datagram carries a header, ReadFrom()
+// returns the client address instead of the proxy address.
+//
+// Datagrams which fail the policy or the validation are dropped, as are
+// datagrams carrying a malformed or a version 1 header.
+type PacketConn struct {
+	PacketConn     net.PacketConn
+	Policy         PolicyFunc
+	ValidateHeader Validator
+	// HeaderFunc, if set, is called on every WriteTo() with the local
+	// address and the destination address, and on every WriteToContext()
+	// with the given context as well. The returned header, if any,
+	// is prepended to the datagram.
+	HeaderFunc HeaderFunc
+}
+
+// ReadFrom reads the next accepted datagram into b, stripped of its proxy
+// protocol header, and returns the address of the client.
+func (p *PacketConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	for {
+		n, addr, err := p.PacketConn.ReadFrom(b)
+		if err != nil {
+			return n, addr, err
+		}
+
+		if n, addr, ok := p.readHeader(b[:n], addr); ok {
+			return n, addr, nil
+		}
+	}
+}
+
+// WriteTo writes a datagram to addr, prepended with the header built by
+// HeaderFunc if it is set. The returned length doesn't include the header.
+func (p *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return p.WriteToContext(context.Background(), b, addr)
+}
+
+// WriteToContext acts as WriteTo, but passes ctx to HeaderFunc so that
+// callers can pass per-datagram values through, such as the address of the
+// client whose datagram is being proxied.
+func (p *PacketConn) WriteToContext(ctx context.Context, b []byte, addr net.Addr) (int, error) {
+	if p.HeaderFunc == nil {
+		return p.PacketConn.WriteTo(b, addr)
+	}
+
+	header, err := p.HeaderFunc(ctx, p.PacketConn.LocalAddr(), addr)
+	if err != nil {
+		return 0, err
+	}
+	if header == nil {
+		return p.PacketConn.WriteTo(b, addr)
+	}
+
+	buf, err := header.Format()
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := p.PacketConn.WriteTo(append(buf, b...), addr)
+	if n -= len(buf); n < 0 {
+		n = 0
+	}
+	return n, err
+}
+
+// Close closes the underlying packet connection.
+func (p *PacketConn) Close() error {
+	return p.PacketConn.Close()
+}
+
+// LocalAddr returns the underlying packet connection's network address.
+func (p *PacketConn) LocalAddr() net.Addr {
+	return p.PacketConn.LocalAddr()
+}
+
+// SetDeadline wraps original PacketConn.SetDeadline
+func (p *PacketConn) SetDeadline(t time.Time) error {
+	return p.PacketConn.SetDeadline(t)
+}
+
+// SetReadDeadline wraps original PacketConn.SetReadDeadline
+func (p *PacketConn) SetReadDeadline(t time.Time) error {
+	return p.PacketConn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline wraps original PacketConn.SetWriteDeadline
+func (p *PacketConn) SetWriteDeadline(t time.Time) error {
+	return p.PacketConn.SetWriteDeadline(t)
+}
+
+// readHeader applies the policy and the validation to the datagram in b.
+// It moves the payload to the beginning of b and returns its length along
+// with the address to report, or false if the datagram must be dropped.
+func (p *PacketConn) readHeader(b []byte, upstream net.Addr) (int, net.Addr, bool) {
+	policy := USE
+	if p.Policy != nil {
+		var err error
+		if policy, err = p.Policy(upstream); err != nil {
+			return 0, nil, false
+		}
+	}
+
+	header, headerLen, err := Parse(b)
+	if err == ErrNeedMoreData {
+		// A datagram too short to hold a signature doesn't carry a header,
+		// while one holding the beginning of a header is truncated.
+		if _, sniffErr := sniffVersion(b); sniffErr != nil {
+			err = ErrNoProxyProtocol
+		}
+	}
+	if err == ErrNoProxyProtocol {
+		if policy == REQUIRE {
+			return 0, nil, false
+		}
+		return len(b), upstream, true
+	}
+	if err != nil || header.Version != 2 || policy == REJECT {
+		return 0, nil, false
+	}
+
+	addr := upstream
+	if policy == USE || policy == REQUIRE {
+		if p.ValidateHeader != nil && p.ValidateHeader(header) != nil {
+			return 0, nil, false
+		}
+		if header.Command.IsProxy() && header.SourceAddr != nil {
+			addr = header.SourceAddr
+		}
+	}
+
+	return copy(b, b[headerLen:]), addr, true
+}
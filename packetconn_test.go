@@ -0,0 +1,306 @@
+package proxyproto
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func newPacketConnPair(t *testing.T) (*net.UDPConn, *net.UDPConn) {
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	client, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	server.SetDeadline(time.Now().Add(time.Second))
+	return server, client
+}
+
+func udpHeader() *Header {
+	return &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: UDPv4,
+		SourceAddr: &net.UDPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.UDPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
+	}
+}
+
+func writeDatagram(t *testing.T, conn net.Conn, header *Header, payload string) {
+	var buf bytes.Buffer
+	if header != nil {
+		if _, err := header.WriteTo(&buf); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	buf.WriteString(payload)
+	if _, err := conn.Write(buf.Bytes()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+}
+
+func TestPacketConnReadFromStripsHeader(t *testing.T) {
+	server, client := newPacketConnPair(t)
+	defer client.Close()
+
+	pc := &PacketConn{PacketConn: server}
+	defer pc.Close()
+
+	writeDatagram(t, client, udpHeader(), "ping")
+
+	recv := make([]byte, 512)
+	n, addr, err := pc.ReadFrom(recv)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv[:n], []byte("ping")) {
+		t.Fatalf("bad: %v", recv[:n])
+	}
+	if addr.String() != "10.1.1.1:1000" {
+		t.Fatalf("bad: %v", addr)
+	}
+	if _, ok := addr.(*net.UDPAddr); !ok {
+		t.Fatalf("expected a UDP address, actual %#v", addr)
+	}
+}
+
+func TestPacketConnReadFromPassthrough(t *testing.T) {
+	server, client := newPacketConnPair(t)
+	defer client.Close()
+
+	pc := &PacketConn{PacketConn: server}
+	defer pc.Close()
+
+	writeDatagram(t, client, nil, "ping")
+
+	recv := make([]byte, 512)
+	n, addr, err := pc.ReadFrom(recv)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv[:n], []byte("ping")) {
+		t.Fatalf("bad: %v", recv[:n])
+	}
+	if addr.String() != client.LocalAddr().String() {
+		t.Fatalf("expected %v, actual %v", client.LocalAddr(), addr)
+	}
+}
+
+func TestPacketConnPolicies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		header   *Header
+		expected string
+		proxied  bool
+	}{
+		{"IGNORE strips header", IGNORE, udpHeader(), "ping", false},
+		{"REJECT drops header", REJECT, udpHeader(), "pong", false},
+		{"REQUIRE drops missing header", REQUIRE, nil, "pong", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := newPacketConnPair(t)
+			defer client.Close()
+
+			pc := &PacketConn{
+				PacketConn: server,
+				Policy:     func(upstream net.Addr) (Policy, error) { return tt.policy, nil },
+			}
+			defer pc.Close()
+
+			// The first datagram is dropped by REJECT and REQUIRE, the second one never is.
+			writeDatagram(t, client, tt.header, "ping")
+			var next *Header
+			if tt.proxied {
+				next = udpHeader()
+			}
+			writeDatagram(t, client, next, "pong")
+
+			recv := make([]byte, 512)
+			n, addr, err := pc.ReadFrom(recv)
+			if err != nil {
+				t.Fatalf("err: %v", err)
+			}
+			if string(recv[:n]) != tt.expected {
+				t.Fatalf("expected %q, actual %q", tt.expected, recv[:n])
+			}
+
+			expectedAddr := client.LocalAddr().String()
+			if tt.proxied {
+				expectedAddr = "10.1.1.1:1000"
+			}
+			if addr.String() != expectedAddr {
+				t.Fatalf("expected %v, actual %v", expectedAddr, addr)
+			}
+		})
+	}
+}
+
+func TestPacketConnDropsInvalidHeaders(t *testing.T) {
+	server, client := newPacketConnPair(t)
+	defer client.Close()
+
+	pc := &PacketConn{
+		PacketConn: server,
+		ValidateHeader: func(header *Header) error {
+			if header.SourceAddr.String() == "10.1.1.1:1000" {
+				return ErrInvalidAddress
+			}
+			return nil
+		},
+	}
+	defer pc.Close()
+
+	writeDatagram(t, client, udpHeader(), "ping")
+	v1 := udpHeader()
+	v1.Version = 1
+	writeDatagram(t, client, v1, "ping")
+	valid := HeaderProxyFromAddrs(2, &net.UDPAddr{IP: net.ParseIP("10.3.3.3"), Port: 3000}, server.LocalAddr())
+	writeDatagram(t, client, valid, "pong")
+
+	recv := make([]byte, 512)
+	n, addr, err := pc.ReadFrom(recv)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv[:n]) != "pong" {
+		t.Fatalf("bad: %q", recv[:n])
+	}
+	if addr.String() != "10.3.3.3:3000" {
+		t.Fatalf("bad: %v", addr)
+	}
+}
+
+func TestPacketConnWriteToPrependsHeader(t *testing.T) {
+	server, client := newPacketConnPair(t)
+	defer client.Close()
+
+	sender, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pc := &PacketConn{
+		PacketConn: sender,
+		HeaderFunc: func(ctx context.Context, source, destination net.Addr) (*Header, error) {
+			return udpHeader(), nil
+		},
+	}
+	defer pc.Close()
+
+	n, err := pc.WriteTo([]byte("ping"), server.LocalAddr())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if n != 4 {
+		t.Fatalf("expected 4 bytes written, actual %d", n)
+	}
+
+	receiver := &PacketConn{PacketConn: server}
+	defer receiver.Close()
+
+	recv := make([]byte, 512)
+	n, addr, err := receiver.ReadFrom(recv)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv[:n]) != "ping" {
+		t.Fatalf("bad: %q", recv[:n])
+	}
+	if addr.String() != "10.1.1.1:1000" {
+		t.Fatalf("bad: %v", addr)
+	}
+}
+
+func TestPacketConnShortDatagrams(t *testing.T) {
+	server, client := newPacketConnPair(t)
+	defer client.Close()
+
+	pc := &PacketConn{PacketConn: server}
+	defer pc.Close()
+
+	raw, err := udpHeader().Format()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	// A truncated header is dropped, a datagram too short for a signature is not
+	client.Write(raw[:len(raw)-1])
+	client.Write([]byte("\r\n"))
+
+	recv := make([]byte, 512)
+	n, addr, err := pc.ReadFrom(recv)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv[:n]) != "\r\n" {
+		t.Fatalf("bad: %q", recv[:n])
+	}
+	if addr.String() != client.LocalAddr().String() {
+		t.Fatalf("expected %v, actual %v", client.LocalAddr(), addr)
+	}
+}
+
+func TestPacketConnReadHeaderDoesNotCopyDatagram(t *testing.T) {
+	pc := &PacketConn{}
+	upstream := &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 1000}
+	datagram := bytes.Repeat([]byte("a"), 1200)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, _, ok := pc.readHeader(datagram, upstream); !ok {
+			t.Fatalf("expected the datagram to be accepted")
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected no allocation, actual %v", allocs)
+	}
+}
+
+func TestPacketConnWriteToContext(t *testing.T) {
+	server, client := newPacketConnPair(t)
+	defer client.Close()
+
+	sender, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pc := &PacketConn{
+		PacketConn: sender,
+		HeaderFunc: func(ctx context.Context, source, destination net.Addr) (*Header, error) {
+			return HeaderProxyFromAddrs(2, ctx.Value(clientAddrKey{}).(net.Addr), destination), nil
+		},
+	}
+	defer pc.Close()
+
+	clientAddr := &net.UDPAddr{IP: net.ParseIP("10.3.3.3"), Port: 3000}
+	ctx := context.WithValue(context.Background(), clientAddrKey{}, net.Addr(clientAddr))
+	if _, err := pc.WriteToContext(ctx, []byte("ping"), server.LocalAddr()); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	receiver := &PacketConn{PacketConn: server}
+	defer receiver.Close()
+
+	recv := make([]byte, 512)
+	n, addr, err := receiver.ReadFrom(recv)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv[:n]) != "ping" {
+		t.Fatalf("bad: %q", recv[:n])
+	}
+	if addr.String() != clientAddr.String() {
+		t.Fatalf("expected %v, actual %v", clientAddr, addr)
+	}
+}
@@ -0,0 +1,53 @@
+package proxyproto
+
+// Parser parses a proxy protocol header incrementally, from the chunks of
+// bytes received on a connection. Unlike Read, it never blocks, which makes
+// it suitable for non-blocking I/O and event loops.
+//
+// The zero value is ready to use. A Parser resets itself once a header has
+// been parsed or an error has been returned, so that it can be reused for
+// another connection.
+type Parser struct {
+	buf []byte
+}
+
+// Feed hands the next chunk of bytes received on the connection over to the
+// parser, which returns either:
+//   - ErrNeedMoreData if the header is incomplete, in which case b has been
+//     copied and Feed should be called again with the next chunk;
+//   - the header, along with the bytes received after it;
+//   - ErrNoProxyProtocol, along with all the bytes received so far, if the
+//     connection doesn't start with a proxy protocol signature;
+//   - any other error if the header is invalid.
+//
+// The leftover bytes may share memory with b.
+func (p *Parser) Feed(b []byte) (header *Header, leftover []byte, err error) {
+	data := b
+	if len(p.buf) > 0 {
+		p.buf = append(p.buf, b...)
+		data = p.buf
+	}
+
+	header, n, err := Parse(data)
+	switch err {
+	case nil:
+		p.Reset()
+		return header, data[n:], nil
+	case ErrNeedMoreData:
+		if len(p.buf) == 0 {
+			p.buf = append(p.buf, b...)
+		}
+		return nil, nil, err
+	case ErrNoProxyProtocol:
+		p.Reset()
+		return nil, data, err
+	default:
+		p.Reset()
+		return nil, nil, err
+	}
+}
+
+// Reset discards the bytes buffered by the parser.
+func (p *Parser) Reset() {
+	p.buf = nil
+}
@@ -0,0 +1,95 @@
+package proxyproto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func feedByteByByte(p *Parser, raw []byte) (*Header, []byte, error) {
+	for i := 0; i < len(raw)-1; i++ {
+		if _, _, err := p.Feed(raw[i : i+1]); err != ErrNeedMoreData {
+			return nil, nil, err
+		}
+	}
+	return p.Feed(raw[len(raw)-1:])
+}
+
+func TestParserFeed(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  []byte
+	}{
+		{"v1 TCP4", []byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n")},
+		{"v2 IPv4", append(append(SIGV2, byte(PROXY), byte(TCPv4)), fixtureIPv4V2...)},
+		{"v2 IPv6 with TLVs", append(append(SIGV2, byte(PROXY), byte(TCPv6)), fixtureIPv6V2TLV...)},
+	}
+
+	var p Parser
+	for _, tt := range tests {
+		expected, err := Read(newBufioReader(tt.raw))
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+
+		header, leftover, err := feedByteByByte(&p, tt.raw)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if !header.EqualsTo(expected) {
+			t.Fatalf("%s: expected %#v, actual %#v", tt.name, expected, header)
+		}
+		if len(leftover) != 0 {
+			t.Fatalf("%s: expected no leftover, actual %v", tt.name, leftover)
+		}
+
+		// The last chunk carries the end of the header and the first payload bytes
+		half := len(tt.raw) / 2
+		if _, _, err := p.Feed(tt.raw[:half]); err != ErrNeedMoreData {
+			t.Fatalf("%s: expected %v, actual %v", tt.name, ErrNeedMoreData, err)
+		}
+		header, leftover, err = p.Feed(append(append([]byte(nil), tt.raw[half:]...), arbitraryTailBytes...))
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", tt.name, err)
+		}
+		if !header.EqualsTo(expected) {
+			t.Fatalf("%s: expected %#v, actual %#v", tt.name, expected, header)
+		}
+		if !bytes.Equal(leftover, arbitraryTailBytes) {
+			t.Fatalf("%s: expected leftover %v, actual %v", tt.name, arbitraryTailBytes, leftover)
+		}
+	}
+}
+
+func TestParserFeedNoProxyProtocol(t *testing.T) {
+	var p Parser
+	if _, _, err := p.Feed([]byte("PRO")); err != ErrNeedMoreData {
+		t.Fatalf("expected %v, actual %v", ErrNeedMoreData, err)
+	}
+
+	_, leftover, err := p.Feed([]byte("TOCOL"))
+	if err != ErrNoProxyProtocol {
+		t.Fatalf("expected %v, actual %v", ErrNoProxyProtocol, err)
+	}
+	if string(leftover) != "PROTOCOL" {
+		t.Fatalf("expected all the bytes received, actual %q", leftover)
+	}
+}
+
+func TestParserFeedResetsAfterError(t *testing.T) {
+	var p Parser
+	if _, _, err := p.Feed(SIGV2); err != ErrNeedMoreData {
+		t.Fatalf("expected %v, actual %v", ErrNeedMoreData, err)
+	}
+	if _, _, err := p.Feed([]byte{invalidRune}); !errors.Is(err, ErrUnsupportedProtocolVersionAndCommand) {
+		t.Fatalf("expected %v, actual %v", ErrUnsupportedProtocolVersionAndCommand, err)
+	}
+
+	header, _, err := p.Feed([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n"))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if header.SourceAddr.String() != "10.1.1.1:1000" {
+		t.Fatalf("bad: %v", header.SourceAddr)
+	}
+}
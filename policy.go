@@ -3,6 +3,8 @@ package proxyproto
 import (
 	"fmt"
 	"net"
+	"net/netip"
+	"strconv"
 	"strings"
 )
 
@@ -14,6 +16,23 @@ import (
 // In case an error is returned the connection is denied.
 type PolicyFunc func(upstream net.Addr) (Policy, error)
 
+// ConnPolicyOptions contains the addresses of a connection, as passed to a
+// ConnPolicyFunc.
+type ConnPolicyOptions struct {
+	// Upstream is the address of the peer, usually a proxy.
+	Upstream net.Addr
+	// Downstream is the local address the connection was accepted on.
+	Downstream net.Addr
+}
+
+// ConnPolicyFunc can be used to decide whether to trust the PROXY info
+// based on both the upstream and the downstream address of a connection,
+// e.g. when a single listener serves several addresses of which only some
+// sit behind proxies.
+//
+// In case an error is returned the connection is denied.
+type ConnPolicyFunc func(connPolicyOptions ConnPolicyOptions) (Policy, error)
+
 // Policy defines how a connection with a PROXY header address is treated.
 type Policy int
 
@@ -23,14 +42,14 @@ const (
 	// IGNORE address from PROXY header, but accept connection
 	IGNORE
 	// REJECT connection when PROXY header is sent
-	// Note: even though the first read on the connection returns an error if
-	// a PROXY header is present, subsequent reads do not. It is the task of
-	// the code using the connection to handle that case properly.
+	// Note: every read on the connection returns ErrSuperfluousProxyHeader
+	// if a PROXY header is present. The underlying connection is only closed
+	// if the Conn was set to close on header errors.
 	REJECT
 	// REQUIRE connection to send PROXY header, reject if not present
-	// Note: even though the first read on the connection returns an error if
-	// a PROXY header is not present, subsequent reads do not. It is the task
-	// of the code using the connection to handle that case properly.
+	// Note: every read on the connection returns ErrNoProxyProtocol if a
+	// PROXY header is not present. The underlying connection is only closed
+	// if the Conn was set to close on header errors.
 	REQUIRE
 )
 
@@ -68,11 +87,10 @@ func MustLaxWhiteListPolicy(allowed []string) PolicyFunc {
 
 // StrictWhiteListPolicy returns a PolicyFunc which decides whether the
 // upstream ip is allowed to send a proxy header based on a list of allowed
-// IP addresses and IP ranges. In case upstream IP is not in list reading on
-// the connection will be refused on the first read. Please note: subsequent
-// reads do not error. It is the task of the code using the connection to
-// handle that case properly. If one of the provided IP addresses or IP
-// ranges is invalid it will return an error instead of a PolicyFunc.
+// IP addresses and IP ranges. In case upstream IP is not in list and sends a
+// proxy header, every read on the connection will be refused. If one of the
+// provided IP addresses or IP ranges is invalid it will return an error
+// instead of a PolicyFunc.
 func StrictWhiteListPolicy(allowed []string) (PolicyFunc, error) {
 	allowFrom, err := parse(allowed)
 	if err != nil {
@@ -93,57 +111,157 @@ func MustStrictWhiteListPolicy(allowed []string) PolicyFunc {
 	return pfunc
 }
 
-func whitelistPolicy(allowed []func(net.IP) bool, def Policy) PolicyFunc {
+// LaxDownstreamWhiteListPolicy returns a ConnPolicyFunc which decides whether
+// the proxy header of a connection is used based on the local address the
+// connection was accepted on. Each allowed entry is an IP address, an IP
+// range, an IP address and port such as "10.0.0.1:443" or "[::1]:443", or
+// a port alone such as ":443". In case the local address matches none of
+// them the proxy header will be ignored. If one of the provided entries is
+// invalid it will return an error instead of a ConnPolicyFunc.
+func LaxDownstreamWhiteListPolicy(allowed []string) (ConnPolicyFunc, error) {
+	allowTo, err := parseDownstream(allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	return downstreamWhitelistPolicy(allowTo, IGNORE), nil
+}
+
+// MustLaxDownstreamWhiteListPolicy returns a LaxDownstreamWhiteListPolicy
+// but will panic if one of the provided entries is invalid.
+func MustLaxDownstreamWhiteListPolicy(allowed []string) ConnPolicyFunc {
+	pfunc, err := LaxDownstreamWhiteListPolicy(allowed)
+	if err != nil {
+		panic(err)
+	}
+
+	return pfunc
+}
+
+// StrictDownstreamWhiteListPolicy acts as LaxDownstreamWhiteListPolicy,
+// except that in case the local address matches none of the allowed
+// entries, every read on a connection sending a proxy header is refused.
+func StrictDownstreamWhiteListPolicy(allowed []string) (ConnPolicyFunc, error) {
+	allowTo, err := parseDownstream(allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	return downstreamWhitelistPolicy(allowTo, REJECT), nil
+}
+
+// MustStrictDownstreamWhiteListPolicy returns a
+// StrictDownstreamWhiteListPolicy but will panic if one of the provided
+// entries is invalid.
+func MustStrictDownstreamWhiteListPolicy(allowed []string) ConnPolicyFunc {
+	pfunc, err := StrictDownstreamWhiteListPolicy(allowed)
+	if err != nil {
+		panic(err)
+	}
+
+	return pfunc
+}
+
+func downstreamWhitelistPolicy(allowed *downstreamSet, def Policy) ConnPolicyFunc {
+	return func(connPolicyOptions ConnPolicyOptions) (Policy, error) {
+		downstream, err := addrPortFromAddr(connPolicyOptions.Downstream)
+		if err != nil {
+			// something is wrong with the local address, better reject the connection
+			return REJECT, err
+		}
+
+		if allowed.contains(downstream) {
+			return USE, nil
+		}
+
+		return def, nil
+	}
+}
+
+func whitelistPolicy(allowed *ipSet, def Policy) PolicyFunc {
 	return func(upstream net.Addr) (Policy, error) {
-		upstreamIP, err := ipFromAddr(upstream)
+		upstreamAddr, err := addrPortFromAddr(upstream)
 		if err != nil {
 			// something is wrong with the source IP, better reject the connection
 			return REJECT, err
 		}
 
-		for _, allowFrom := range allowed {
-			if allowFrom(upstreamIP) {
-				return USE, nil
-			}
+		if allowed.contains(upstreamAddr.Addr()) {
+			return USE, nil
 		}
 
 		return def, nil
 	}
 }
 
-func parse(allowed []string) ([]func(net.IP) bool, error) {
-	a := make([]func(net.IP) bool, len(allowed))
-	for i, allowFrom := range allowed {
+func parse(allowed []string) (*ipSet, error) {
+	a := new(ipSet)
+	for _, allowFrom := range allowed {
 		if strings.LastIndex(allowFrom, "/") > 0 {
-			_, ipRange, err := net.ParseCIDR(allowFrom)
+			ipRange, err := netip.ParsePrefix(allowFrom)
 			if err != nil {
 				return nil, fmt.Errorf("Given string %q is not a valid IP range: %v", allowFrom, err)
 			}
 
-			a[i] = ipRange.Contains
+			a.insert(ipRange.Masked())
 		} else {
-			allowed := net.ParseIP(allowFrom)
-			if allowed == nil {
+			allowed, err := netip.ParseAddr(allowFrom)
+			if err != nil || allowed.Zone() != "" {
 				return nil, fmt.Errorf("Given string %q is not a valid IP address", allowFrom)
 			}
 
-			a[i] = allowed.Equal
+			a.insert(netip.PrefixFrom(allowed, allowed.BitLen()))
 		}
 	}
 
 	return a, nil
 }
 
-func ipFromAddr(upstream net.Addr) (net.IP, error) {
-	upstreamString, _, err := net.SplitHostPort(upstream.String())
-	if err != nil {
-		return nil, err
+// downstreamSet is the set of local addresses of a downstream whitelist.
+type downstreamSet struct {
+	ips       *ipSet
+	ports     map[uint16]bool
+	addrPorts map[netip.AddrPort]bool
+}
+
+func (s *downstreamSet) contains(addrPort netip.AddrPort) bool {
+	return s.ips.contains(addrPort.Addr()) || s.ports[addrPort.Port()] || s.addrPorts[addrPort]
+}
+
+// parseDownstream parses the entries of a downstream whitelist, which may
+// also carry a port.
+func parseDownstream(allowed []string) (*downstreamSet, error) {
+	var ips []string
+	a := &downstreamSet{
+		ports:     make(map[uint16]bool),
+		addrPorts: make(map[netip.AddrPort]bool),
 	}
+	for _, allowTo := range allowed {
+		host, portString, err := net.SplitHostPort(allowTo)
+		if err != nil {
+			// No port, any port matches
+			ips = append(ips, allowTo)
+			continue
+		}
 
-	upstreamIP := net.ParseIP(upstreamString)
-	if nil == upstreamIP {
-		return nil, fmt.Errorf("invalid IP address")
+		port, err := strconv.Atoi(portString)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("Given string %q doesn't have a valid port", allowTo)
+		}
+		if host == "" {
+			a.ports[uint16(port)] = true
+			continue
+		}
+		allowIP, err := netip.ParseAddr(host)
+		if err != nil || allowIP.Zone() != "" {
+			return nil, fmt.Errorf("Given string %q is not a valid IP address", allowTo)
+		}
+		a.addrPorts[netip.AddrPortFrom(allowIP.Unmap(), uint16(port))] = true
 	}
 
-	return upstreamIP, nil
+	var err error
+	if a.ips, err = parse(ips); err != nil {
+		return nil, err
+	}
+	return a, nil
 }
@@ -188,3 +188,61 @@ func Test_MustStrictWhiteListPolicyPanicsWithInvalidIpRange(t *testing.T) {
 
 	MustStrictWhiteListPolicy([]string{"20/80"})
 }
+
+func TestDownstreamWhitelistPolicy(t *testing.T) {
+	allowed := []string{"10.0.0.1", "10.0.1.0/24", "10.0.2.1:443", "[::1]:8443", ":9443"}
+	var cases = []struct {
+		downstream string
+		lax        Policy
+		strict     Policy
+	}{
+		{"10.0.0.1:80", USE, USE},
+		{"10.0.1.5:80", USE, USE},
+		{"10.0.2.1:443", USE, USE},
+		{"10.0.2.1:80", IGNORE, REJECT},
+		{"[::1]:8443", USE, USE},
+		{"[::1]:443", IGNORE, REJECT},
+		{"10.0.3.1:9443", USE, USE},
+		{"10.0.3.1:443", IGNORE, REJECT},
+	}
+
+	lax := MustLaxDownstreamWhiteListPolicy(allowed)
+	strict := MustStrictDownstreamWhiteListPolicy(allowed)
+	upstream, err := net.ResolveTCPAddr("tcp", "192.168.0.1:45738")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	for _, tc := range cases {
+		downstream, err := net.ResolveTCPAddr("tcp", tc.downstream)
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+		opts := ConnPolicyOptions{Upstream: upstream, Downstream: downstream}
+
+		if policy, err := lax(opts); err != nil || policy != tc.lax {
+			t.Fatalf("%s: expected lax policy %v, got %v (%v)", tc.downstream, tc.lax, policy, err)
+		}
+		if policy, err := strict(opts); err != nil || policy != tc.strict {
+			t.Fatalf("%s: expected strict policy %v, got %v (%v)", tc.downstream, tc.strict, policy, err)
+		}
+	}
+}
+
+func TestDownstreamWhitelistPolicyReturnsErrorOnInvalidAddress(t *testing.T) {
+	p := MustLaxDownstreamWhiteListPolicy([]string{"10.0.0.1"})
+	if _, err := p(ConnPolicyOptions{Downstream: failingAddr{}}); err == nil {
+		t.Fatal("Expected error, got none")
+	}
+}
+
+func Test_CreateDownstreamWhitelistPolicyWithInvalidEntriesReturnsError(t *testing.T) {
+	for _, entry := range []string{"10.0.0.1:0", "10.0.0.1:https", "10.0.0.256:443", "10.0.0.0/33", "not-an-ip"} {
+		if _, err := LaxDownstreamWhiteListPolicy([]string{entry}); err == nil {
+			t.Fatalf("%s: Expected error, got none", entry)
+		}
+		if _, err := StrictDownstreamWhiteListPolicy([]string{entry}); err == nil {
+			t.Fatalf("%s: Expected error, got none", entry)
+		}
+	}
+}
@@ -2,8 +2,10 @@ package proxyproto
 
 import (
 	"bufio"
+	"fmt"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,9 +14,43 @@ import (
 // If the connection is using the protocol, the RemoteAddr() will return
 // the correct client address.
 type Listener struct {
-	Listener       net.Listener
-	Policy         PolicyFunc
+	Listener net.Listener
+	Policy   PolicyFunc
+	// ConnPolicy, if set, takes precedence over Policy. It receives the local
+	// address of each connection along with the upstream one.
+	ConnPolicy     ConnPolicyFunc
 	ValidateHeader Validator
+	// ReadHeaderTimeout, if positive, is the maximum amount of time allowed
+	// to read the proxy header of each connection. It is enforced with a read
+	// deadline on the underlying connection.
+	ReadHeaderTimeout time.Duration
+	// ReadOptions limits the size of the proxy header of each connection.
+	ReadOptions ReadOptions
+	// CloseOnHeaderError closes the underlying connection as soon as reading
+	// or validating its proxy header fails, instead of leaving it open until
+	// the caller closes it.
+	CloseOnHeaderError bool
+	// HeaderWorkers, if positive, makes Accept read and validate the proxy
+	// header of new connections in background goroutines, at most
+	// HeaderWorkers at a time, and only return connections whose header was
+	// successfully processed. The other connections are closed. Setting a
+	// ReadHeaderTimeout is recommended, so that silent clients can't hold
+	// on to a worker.
+	HeaderWorkers int
+
+	initOnce  sync.Once
+	loopOnce  sync.Once
+	closeOnce sync.Once
+	doneOnce  sync.Once
+	accepted  chan acceptResult
+	closing   chan struct{}
+	done      chan struct{}
+	acceptErr error
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
 }
 
 // Conn is used to wrap and underlying connection which
@@ -28,6 +64,29 @@ type Conn struct {
 	ProxyHeaderPolicy Policy
 	Validate          Validator
 	readErr           error
+	readHeaderTimeout time.Duration
+	readOptions       ReadOptions
+	closeOnError      bool
+	readDeadline      atomic.Value // time.Time
+}
+
+// HeaderError is returned by Conn when the proxy header of the connection
+// couldn't be read, or was refused by the policy or the validator. Err is
+// the reason, e.g. ErrSuperfluousProxyHeader, a *ParseError or the error of
+// the validator.
+type HeaderError struct {
+	// Upstream is the address of the peer which sent the header.
+	Upstream net.Addr
+	Err      error
+}
+
+func (e *HeaderError) Error() string {
+	return fmt.Sprintf("Proxy protocol header from %v refused: %v", e.Upstream, e.Err)
+}
+
+// Unwrap returns the reason why the header was refused.
+func (e *HeaderError) Unwrap() error {
+	return e.Err
 }
 
 // Validator receives a header and decides whether it is a valid one
@@ -43,40 +102,170 @@ func ValidateHeader(v Validator) func(*Conn) {
 	}
 }
 
+// SetReadHeaderTimeout sets the maximum amount of time allowed to read the
+// proxy header of a connection when passed as option to NewConn()
+func SetReadHeaderTimeout(t time.Duration) func(*Conn) {
+	return func(c *Conn) {
+		c.readHeaderTimeout = t
+	}
+}
+
 // Accept waits for and returns the next connection to the listener.
 func (p *Listener) Accept() (net.Conn, error) {
+	if p.HeaderWorkers > 0 {
+		return p.acceptProcessed()
+	}
+
 	// Get the underlying connection
 	conn, err := p.Listener.Accept()
 	if err != nil {
 		return nil, err
 	}
 
+	newConn, err := p.newConn(conn)
+	if err != nil {
+		// can't decide the policy, we can't accept the connection
+		conn.Close()
+		return nil, err
+	}
+	return newConn, nil
+}
+
+// Close closes the underlying listener.
+func (p *Listener) Close() error {
+	p.init()
+	p.closeOnce.Do(func() { close(p.closing) })
+	return p.Listener.Close()
+}
+
+// Addr returns the underlying listener's network address.
+func (p *Listener) Addr() net.Addr {
+	return p.Listener.Addr()
+}
+
+func (p *Listener) newConn(conn net.Conn) (*Conn, error) {
 	proxyHeaderPolicy := USE
-	if p.Policy != nil {
+	var err error
+	if p.ConnPolicy != nil {
+		proxyHeaderPolicy, err = p.ConnPolicy(ConnPolicyOptions{
+			Upstream:   conn.RemoteAddr(),
+			Downstream: conn.LocalAddr(),
+		})
+	} else if p.Policy != nil {
 		proxyHeaderPolicy, err = p.Policy(conn.RemoteAddr())
-		if err != nil {
-			// can't decide the policy, we can't accept the connection
-			conn.Close()
-			return nil, err
-		}
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	newConn := NewConn(
 		conn,
 		WithPolicy(proxyHeaderPolicy),
 		ValidateHeader(p.ValidateHeader),
+		SetReadHeaderTimeout(p.ReadHeaderTimeout),
+		WithReadOptions(p.ReadOptions),
+		SetCloseOnHeaderError(p.CloseOnHeaderError),
 	)
 	return newConn, nil
 }
 
-// Close closes the underlying listener.
-func (p *Listener) Close() error {
-	return p.Listener.Close()
+func (p *Listener) init() {
+	p.initOnce.Do(func() {
+		p.accepted = make(chan acceptResult)
+		p.closing = make(chan struct{})
+		p.done = make(chan struct{})
+	})
 }
 
-// Addr returns the underlying listener's network address.
-func (p *Listener) Addr() net.Addr {
-	return p.Listener.Addr()
+// acceptProcessed returns the next connection whose header was processed
+// by a worker, or the error which stopped the accept loop.
+func (p *Listener) acceptProcessed() (net.Conn, error) {
+	p.init()
+	p.loopOnce.Do(func() { go p.acceptLoop() })
+
+	select {
+	case result := <-p.accepted:
+		return result.conn, result.err
+	case <-p.done:
+		return nil, p.acceptErr
+	}
+}
+
+func (p *Listener) acceptLoop() {
+	workers := make(chan struct{}, p.HeaderWorkers)
+	for {
+		conn, err := p.Listener.Accept()
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Temporary() {
+				// Let the caller decide how to handle temporary errors
+				select {
+				case p.accepted <- acceptResult{err: err}:
+				case <-p.closing:
+				}
+				continue
+			}
+
+			p.doneOnce.Do(func() {
+				p.acceptErr = err
+				close(p.done)
+			})
+			return
+		}
+
+		select {
+		case workers <- struct{}{}:
+		case <-p.closing:
+			// The next Accept fails on the closed listener
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer func() { <-workers }()
+			p.processConn(conn)
+		}()
+	}
+}
+
+// processConn reads the header of conn and hands it over to Accept, unless
+// it fails the policy or the validation.
+func (p *Listener) processConn(conn net.Conn) {
+	newConn, err := p.newConn(conn)
+	if err != nil {
+		conn.Close()
+		return
+	}
+
+	newConn.once.Do(newConn.processHeader)
+	if newConn.readErr != nil {
+		newConn.Close()
+		return
+	}
+
+	select {
+	case p.accepted <- acceptResult{conn: newConn}:
+	case <-p.closing:
+		newConn.Close()
+	case <-p.done:
+		newConn.Close()
+	}
+}
+
+// WithReadOptions sets the limits applied when reading the proxy header of
+// a connection when passed as option to NewConn()
+func WithReadOptions(opts ReadOptions) func(*Conn) {
+	return func(c *Conn) {
+		c.readOptions = opts
+	}
+}
+
+// SetCloseOnHeaderError makes a connection close its underlying connection
+// when reading or validating the proxy header fails, when passed as option
+// to NewConn()
+func SetCloseOnHeaderError(enabled bool) func(*Conn) {
+	return func(c *Conn) {
+		c.closeOnError = enabled
+	}
 }
 
 // NewConn is used to wrap a net.Conn that may be speaking
@@ -95,12 +284,13 @@ func NewConn(conn net.Conn, opts ...func(*Conn)) *Conn {
 }
 
 // Read is check for the proxy protocol header when doing
-// the initial scan. If there is an error parsing the header,
-// it is returned and the socket is closed.
+// the initial scan. If there is an error parsing or validating
+// the header, it is returned as a *HeaderError by this and every
+// subsequent Read.
+// The underlying socket is only closed if the connection was
+// set to close on header errors.
 func (p *Conn) Read(b []byte) (int, error) {
-	p.once.Do(func() {
-		p.readErr = p.readHeader()
-	})
+	p.once.Do(p.processHeader)
 	if p.readErr != nil {
 		return 0, p.readErr
 	}
@@ -124,8 +314,8 @@ func (p *Conn) Close() error {
 // from the proxy header even if the proxy header itself is
 // syntactically correct.
 func (p *Conn) LocalAddr() net.Addr {
-	p.once.Do(func() { p.readErr = p.readHeader() })
-	if p.header == nil || p.header.Command.IsLocal() || p.readErr != nil {
+	p.once.Do(p.processHeader)
+	if p.header == nil || p.header.Command.IsLocal() || p.header.DestinationAddr == nil || p.readErr != nil {
 		return p.conn.LocalAddr()
 	}
 
@@ -139,21 +329,31 @@ func (p *Conn) LocalAddr() net.Addr {
 // from the proxy header even if the proxy header itself is
 // syntactically correct.
 func (p *Conn) RemoteAddr() net.Addr {
-	p.once.Do(func() { p.readErr = p.readHeader() })
-	if p.header == nil || p.header.Command.IsLocal() || p.readErr != nil {
+	p.once.Do(p.processHeader)
+	if p.header == nil || p.header.Command.IsLocal() || p.header.SourceAddr == nil || p.readErr != nil {
 		return p.conn.RemoteAddr()
 	}
 
 	return p.header.RemoteAddr()
 }
 
+// ProxyHeader returns the proxy protocol header, if any. If an error occurs
+// while reading the proxy header, or the header was ignored because of the
+// connection's policy, nil is returned.
+func (p *Conn) ProxyHeader() *Header {
+	p.once.Do(p.processHeader)
+	return p.header
+}
+
 // SetDeadline wraps original conn.SetDeadline
 func (p *Conn) SetDeadline(t time.Time) error {
+	p.readDeadline.Store(t)
 	return p.conn.SetDeadline(t)
 }
 
 // SetReadDeadline wraps original conn.SetReadDeadline
 func (p *Conn) SetReadDeadline(t time.Time) error {
+	p.readDeadline.Store(t)
 	return p.conn.SetReadDeadline(t)
 }
 
@@ -162,8 +362,43 @@ func (p *Conn) SetWriteDeadline(t time.Time) error {
 	return p.conn.SetWriteDeadline(t)
 }
 
+// processHeader reads the proxy header and records the error, if any, so
+// that the connection stays unusable after a failure.
+func (p *Conn) processHeader() {
+	err := p.readHeader()
+	if err == nil {
+		return
+	}
+
+	p.readErr = &HeaderError{
+		Upstream: p.conn.RemoteAddr(),
+		Err:      err,
+	}
+	if p.closeOnError {
+		p.conn.Close()
+	}
+}
+
 func (p *Conn) readHeader() error {
-	header, err := Read(p.bufReader)
+	var deadline time.Time
+	if p.readHeaderTimeout > 0 {
+		deadline = time.Now().Add(p.readHeaderTimeout)
+		if err := p.conn.SetReadDeadline(deadline); err != nil {
+			return err
+		}
+		// Restore the deadline set by the user of the connection, if any
+		defer func() {
+			previous, _ := p.readDeadline.Load().(time.Time)
+			p.conn.SetReadDeadline(previous)
+		}()
+	}
+
+	header, err := ReadWithOptions(p.bufReader, p.readOptions)
+	// Read hides the I/O error behind the parsing error, but reads can only
+	// fail past the deadline because it was reached.
+	if err != nil && !deadline.IsZero() && !time.Now().Before(deadline) {
+		return ErrReadHeaderTimeout
+	}
 	// For the purpose of this wrapper shamefully stolen from armon/go-proxyproto
 	// let's act as if there was no error when PROXY protocol is not present.
 	if err == ErrNoProxyProtocol {
@@ -6,9 +6,12 @@ package proxyproto
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"testing"
+	"time"
 )
 
 func TestPassthrough(t *testing.T) {
@@ -74,13 +77,17 @@ func TestParse_ipv4(t *testing.T) {
 
 		// Write out the header!
 		header := &Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  TCPv4,
-			SourceAddress:      net.ParseIP("10.1.1.1"),
-			SourcePort:         1000,
-			DestinationAddress: net.ParseIP("20.2.2.2"),
-			DestinationPort:    2000,
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   net.ParseIP("10.1.1.1"),
+				Port: 1000,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   net.ParseIP("20.2.2.2"),
+				Port: 2000,
+			},
 		}
 		header.WriteTo(conn)
 
@@ -141,13 +148,17 @@ func TestParse_ipv6(t *testing.T) {
 
 		// Write out the header!
 		header := &Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  TCPv6,
-			SourceAddress:      net.ParseIP("ffff::ffff"),
-			SourcePort:         1000,
-			DestinationAddress: net.ParseIP("ffff::ffff"),
-			DestinationPort:    2000,
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv6,
+			SourceAddr: &net.TCPAddr{
+				IP:   net.ParseIP("ffff::ffff"),
+				Port: 1000,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   net.ParseIP("ffff::ffff"),
+				Port: 2000,
+			},
 		}
 		header.WriteTo(conn)
 
@@ -247,7 +258,7 @@ func TestReadingIsRefusedWhenProxyHeaderRequiredButMissing(t *testing.T) {
 
 	recv := make([]byte, 4)
 	_, err = conn.Read(recv)
-	if err != ErrNoProxyProtocol {
+	if !errors.Is(err, ErrNoProxyProtocol) {
 		t.Fatalf("Expected error %v, received %v", ErrNoProxyProtocol, err)
 	}
 }
@@ -269,13 +280,17 @@ func TestReadingIsRefusedWhenProxyHeaderPresentButNotAllowed(t *testing.T) {
 		}
 		defer conn.Close()
 		header := &Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  TCPv4,
-			SourceAddress:      net.ParseIP("10.1.1.1"),
-			SourcePort:         1000,
-			DestinationAddress: net.ParseIP("20.2.2.2"),
-			DestinationPort:    2000,
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   net.ParseIP("10.1.1.1"),
+				Port: 1000,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   net.ParseIP("20.2.2.2"),
+				Port: 2000,
+			},
 		}
 		header.WriteTo(conn)
 	}()
@@ -288,7 +303,7 @@ func TestReadingIsRefusedWhenProxyHeaderPresentButNotAllowed(t *testing.T) {
 
 	recv := make([]byte, 4)
 	_, err = conn.Read(recv)
-	if err != ErrSuperfluousProxyHeader {
+	if !errors.Is(err, ErrSuperfluousProxyHeader) {
 		t.Fatalf("Expected error %v, received %v", ErrSuperfluousProxyHeader, err)
 	}
 }
@@ -311,13 +326,17 @@ func TestIgnorePolicyIgnoresIpFromProxyHeader(t *testing.T) {
 
 		// Write out the header!
 		header := &Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  TCPv4,
-			SourceAddress:      net.ParseIP("10.1.1.1"),
-			SourcePort:         1000,
-			DestinationAddress: net.ParseIP("20.2.2.2"),
-			DestinationPort:    2000,
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   net.ParseIP("10.1.1.1"),
+				Port: 1000,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   net.ParseIP("20.2.2.2"),
+				Port: 2000,
+			},
 		}
 		header.WriteTo(conn)
 
@@ -414,7 +433,7 @@ func TestReadingIsRefusedOnErrorWhenRemoteAddrRequestedFirst(t *testing.T) {
 	_ = conn.RemoteAddr()
 	recv := make([]byte, 4)
 	_, err = conn.Read(recv)
-	if err != ErrNoProxyProtocol {
+	if !errors.Is(err, ErrNoProxyProtocol) {
 		t.Fatalf("Expected error %v, received %v", ErrNoProxyProtocol, err)
 	}
 }
@@ -447,7 +466,7 @@ func TestReadingIsRefusedOnErrorWhenLocalAddrRequestedFirst(t *testing.T) {
 	_ = conn.LocalAddr()
 	recv := make([]byte, 4)
 	_, err = conn.Read(recv)
-	if err != ErrNoProxyProtocol {
+	if !errors.Is(err, ErrNoProxyProtocol) {
 		t.Fatalf("Expected error %v, received %v", ErrNoProxyProtocol, err)
 	}
 }
@@ -470,13 +489,17 @@ func Test_ConnectionErrorsWhenHeaderValidationFails(t *testing.T) {
 
 		// Write out the header!
 		header := &Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  TCPv4,
-			SourceAddress:      net.ParseIP("10.1.1.1"),
-			SourcePort:         1000,
-			DestinationAddress: net.ParseIP("20.2.2.2"),
-			DestinationPort:    2000,
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   net.ParseIP("10.1.1.1"),
+				Port: 1000,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   net.ParseIP("20.2.2.2"),
+				Port: 2000,
+			},
 		}
 		header.WriteTo(conn)
 	}()
@@ -489,7 +512,575 @@ func Test_ConnectionErrorsWhenHeaderValidationFails(t *testing.T) {
 
 	recv := make([]byte, 4)
 	_, err = conn.Read(recv)
-	if err != validationError {
+	if !errors.Is(err, validationError) {
 		t.Fatalf("expected validation error, got %v", err)
 	}
 }
+
+func TestConnProxyHeader(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l}
+
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
+		rawTLVs: formatTLV(TLV{Type: PP2_TYPE_AUTHORITY, Length: 11, Value: []byte("example.com")}),
+	}
+
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			t.Errorf("err: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		header.WriteTo(conn)
+		conn.Write([]byte("ping"))
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	proxyHeader := conn.(*Conn).ProxyHeader()
+	if !proxyHeader.EqualsTo(header) {
+		t.Fatalf("expected %#v, actual %#v", header, proxyHeader)
+	}
+
+	tlvs, err := proxyHeader.TLVs()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if len(tlvs) != 1 || tlvs[0].Type != PP2_TYPE_AUTHORITY || string(tlvs[0].Value) != "example.com" {
+		t.Fatalf("unexpected TLVs %#v", tlvs)
+	}
+
+	recv := make([]byte, 4)
+	if _, err = conn.Read(recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv, []byte("ping")) {
+		t.Fatalf("bad: %v", recv)
+	}
+}
+
+func TestConnProxyHeaderIsNilWhenIgnored(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		header := &Header{
+			Version:           1,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   net.ParseIP("10.1.1.1"),
+				Port: 1000,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   net.ParseIP("20.2.2.2"),
+				Port: 2000,
+			},
+		}
+		header.WriteTo(client)
+	}()
+
+	conn := NewConn(server, WithPolicy(IGNORE))
+	defer conn.Close()
+
+	if header := conn.ProxyHeader(); header != nil {
+		t.Fatalf("expected no header, actual %#v", header)
+	}
+}
+
+func TestConnRemoteAddrIsUnixAddr(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		header := &Header{
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: UnixStream,
+			SourceAddr: &net.UnixAddr{
+				Net:  "unix",
+				Name: "/run/src.sock",
+			},
+			DestinationAddr: &net.UnixAddr{
+				Net:  "unix",
+				Name: "/run/dst.sock",
+			},
+		}
+		header.WriteTo(client)
+	}()
+
+	conn := NewConn(server)
+	defer conn.Close()
+
+	remoteAddr, ok := conn.RemoteAddr().(*net.UnixAddr)
+	if !ok || remoteAddr.Name != "/run/src.sock" {
+		t.Fatalf("expected Unix address /run/src.sock, actual %#v", conn.RemoteAddr())
+	}
+	localAddr, ok := conn.LocalAddr().(*net.UnixAddr)
+	if !ok || localAddr.Name != "/run/dst.sock" {
+		t.Fatalf("expected Unix address /run/dst.sock, actual %#v", conn.LocalAddr())
+	}
+}
+
+func TestReadHeaderTimeoutWithSilentClient(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l, ReadHeaderTimeout: 50 * time.Millisecond}
+
+	for _, sent := range []string{"", "PROXY TCP4 "} {
+		done := make(chan struct{})
+		go func(sent string) {
+			conn, err := net.Dial("tcp", pl.Addr().String())
+			if err != nil {
+				t.Errorf("err: %v", err)
+				return
+			}
+			defer conn.Close()
+			conn.Write([]byte(sent))
+			<-done
+		}(sent)
+
+		conn, err := pl.Accept()
+		if err != nil {
+			t.Fatalf("err: %v", err)
+		}
+
+		start := time.Now()
+		recv := make([]byte, 4)
+		_, err = conn.Read(recv)
+		if !errors.Is(err, ErrReadHeaderTimeout) {
+			t.Fatalf("expected %v, actual %v", ErrReadHeaderTimeout, err)
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("expected timeout after 50ms, took %v", elapsed)
+		}
+
+		close(done)
+		conn.Close()
+	}
+}
+
+func TestReadHeaderTimeoutRestoresDeadline(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l, ReadHeaderTimeout: 50 * time.Millisecond}
+
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			t.Errorf("err: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		header := &Header{
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   net.ParseIP("10.1.1.1"),
+				Port: 1000,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   net.ParseIP("20.2.2.2"),
+				Port: 2000,
+			},
+		}
+		header.WriteTo(conn)
+
+		// Outlive the header timeout before sending data
+		time.Sleep(150 * time.Millisecond)
+		conn.Write([]byte("ping"))
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	if addr := conn.RemoteAddr().String(); addr != "10.1.1.1:1000" {
+		t.Fatalf("bad: %v", addr)
+	}
+
+	recv := make([]byte, 4)
+	if _, err = conn.Read(recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv, []byte("ping")) {
+		t.Fatalf("bad: %v", recv)
+	}
+}
+
+func TestReadHeaderTimeoutRestoresUserDeadline(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		client.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\n"))
+	}()
+
+	conn := NewConn(server, SetReadHeaderTimeout(time.Second))
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+
+	recv := make([]byte, 4)
+	_, err := conn.Read(recv)
+	if netErr, ok := err.(net.Error); !ok || !netErr.Timeout() {
+		t.Fatalf("expected a timeout error, actual %v", err)
+	}
+	if addr := conn.RemoteAddr().String(); addr != "10.1.1.1:1000" {
+		t.Fatalf("bad: %v", addr)
+	}
+}
+
+func TestHeaderWorkersAcceptOnlyProcessedConnections(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{
+		Listener:          l,
+		Policy:            func(upstream net.Addr) (Policy, error) { return REQUIRE, nil },
+		ReadHeaderTimeout: time.Second,
+		HeaderWorkers:     2,
+	}
+	defer pl.Close()
+
+	// A silent client holds a worker until its header times out
+	silent, err := net.Dial("tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer silent.Close()
+
+	// A client without header is closed without being accepted
+	rejected, err := net.Dial("tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer rejected.Close()
+	rejected.Write([]byte("ping"))
+
+	proxied, err := net.Dial("tcp", pl.Addr().String())
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer proxied.Close()
+	proxied.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping"))
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	if addr := conn.RemoteAddr().String(); addr != "10.1.1.1:1000" {
+		t.Fatalf("bad: %v", addr)
+	}
+	recv := make([]byte, 4)
+	if _, err := conn.Read(recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if !bytes.Equal(recv, []byte("ping")) {
+		t.Fatalf("bad: %v", recv)
+	}
+
+	rejected.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := rejected.Read(recv); err == nil {
+		t.Fatal("expected rejected connection to be closed")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatalf("expected rejected connection to be closed, actual %v", err)
+	}
+}
+
+func TestHeaderWorkersAcceptFailsAfterClose(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l, HeaderWorkers: 1}
+
+	accepted := make(chan error, 1)
+	go func() {
+		_, err := pl.Accept()
+		accepted <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	pl.Close()
+
+	select {
+	case err := <-accepted:
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Accept didn't return after Close")
+	}
+
+	if _, err := pl.Accept(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestHeaderErrorsAreSticky(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		payload  string
+		expected error
+	}{
+		{"REJECT with header", REJECT, "PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping", ErrSuperfluousProxyHeader},
+		{"REQUIRE without header", REQUIRE, "GET / HTTP/1.1\r\n\r\n", ErrNoProxyProtocol},
+	}
+
+	for _, tt := range tests {
+		for _, closeOnError := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s closeOnError=%v", tt.name, closeOnError), func(t *testing.T) {
+				server, client := net.Pipe()
+				defer client.Close()
+
+				go client.Write([]byte(tt.payload))
+
+				conn := NewConn(server, WithPolicy(tt.policy), SetCloseOnHeaderError(closeOnError))
+				defer conn.Close()
+
+				recv := make([]byte, 4)
+				for i := 0; i < 3; i++ {
+					if _, err := conn.Read(recv); !errors.Is(err, tt.expected) {
+						t.Fatalf("read %d: expected %v, actual %v", i, tt.expected, err)
+					}
+				}
+
+				if closeOnError {
+					if _, err := conn.Write([]byte("pong")); err != io.ErrClosedPipe {
+						t.Fatalf("expected the connection to be closed, actual %v", err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestListenerCloseOnHeaderError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{
+		Listener:           l,
+		Policy:             func(upstream net.Addr) (Policy, error) { return REQUIRE, nil },
+		CloseOnHeaderError: true,
+	}
+	defer pl.Close()
+
+	cliResult := make(chan error)
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("GET / HTTP/1.1\r\n\r\n"))
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		recv := make([]byte, 4)
+		if _, err := conn.Read(recv); err != io.EOF {
+			cliResult <- fmt.Errorf("expected the server to close the connection, actual %v", err)
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	recv := make([]byte, 4)
+	if _, err := conn.Read(recv); !errors.Is(err, ErrNoProxyProtocol) {
+		t.Fatalf("expected %v, actual %v", ErrNoProxyProtocol, err)
+	}
+
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+}
+
+func TestListenerReadOptions(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{
+		Listener:    l,
+		ReadOptions: ReadOptions{MaxHeaderSize: 28},
+	}
+	defer pl.Close()
+
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+		DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("20.2.2.2"), Port: 2000},
+	}
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_NOOP, Length: 16}}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			t.Errorf("err: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		header.WriteTo(conn)
+		conn.Write([]byte("ping"))
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	recv := make([]byte, 4)
+	if _, err := conn.Read(recv); !errors.Is(err, ErrHeaderTooLarge) {
+		t.Fatalf("expected %v, actual %v", ErrHeaderTooLarge, err)
+	}
+}
+
+func TestHeaderErrorCarriesUpstreamAddress(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	pl := &Listener{Listener: l}
+	defer pl.Close()
+
+	cliResult := make(chan net.Addr, 1)
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			t.Errorf("err: %v", err)
+			close(cliResult)
+			return
+		}
+		defer conn.Close()
+
+		cliResult <- conn.LocalAddr()
+		conn.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 65536\r\n"))
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	recv := make([]byte, 4)
+	_, err = conn.Read(recv)
+
+	var headerErr *HeaderError
+	if !errors.As(err, &headerErr) {
+		t.Fatalf("expected a *HeaderError, actual %#v", err)
+	}
+	if upstream := <-cliResult; headerErr.Upstream.String() != upstream.String() {
+		t.Fatalf("expected upstream %v, actual %v", upstream, headerErr.Upstream)
+	}
+
+	var parseErr *ParseError
+	if !errors.As(err, &parseErr) || parseErr.Field != "destination port" {
+		t.Fatalf("expected a destination port *ParseError, actual %#v", err)
+	}
+	if !errors.Is(err, ErrInvalidPortNumber) {
+		t.Fatalf("expected %v, actual %v", ErrInvalidPortNumber, err)
+	}
+}
+
+func TestConnPolicyTakesPrecedenceOverPolicy(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var downstream net.Addr
+	pl := &Listener{
+		Listener: l,
+		Policy:   func(upstream net.Addr) (Policy, error) { return REJECT, nil },
+		ConnPolicy: func(opts ConnPolicyOptions) (Policy, error) {
+			downstream = opts.Downstream
+			return USE, nil
+		},
+	}
+	defer pl.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			t.Errorf("err: %v", err)
+			return
+		}
+		defer conn.Close()
+
+		conn.Write([]byte("PROXY TCP4 10.1.1.1 20.2.2.2 1000 2000\r\nping"))
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	if downstream == nil || downstream.String() != pl.Addr().String() {
+		t.Fatalf("expected downstream %v, actual %v", pl.Addr(), downstream)
+	}
+
+	recv := make([]byte, 4)
+	if _, err := conn.Read(recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if addr := conn.RemoteAddr().String(); addr != "10.1.1.1:1000" {
+		t.Fatalf("bad: %v", addr)
+	}
+}
@@ -0,0 +1,43 @@
+package proxyproto
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// NewTLSListener returns a listener accepting TLS connections which start
+// with a proxy protocol header, as sent by load balancers forwarding TCP
+// before the TLS handshake. The header is read from inner by a Listener,
+// configured by the given options, before the TLS handshake starts. The
+// returned connections are *tls.Conn values whose RemoteAddr() and
+// LocalAddr() reflect the header.
+//
+// The header of a connection can be retrieved with HeaderFromConn, from the
+// connection itself or from the Conn field of the tls.ClientHelloInfo given
+// to callbacks such as tls.Config.GetConfigForClient.
+func NewTLSListener(inner net.Listener, config *tls.Config, opts ...func(*Listener)) net.Listener {
+	listener := &Listener{Listener: inner}
+	for _, opt := range opts {
+		opt(listener)
+	}
+
+	return tls.NewListener(listener, config)
+}
+
+// HeaderFromConn returns the proxy protocol header of a connection accepted
+// by a Listener, also when it is wrapped by a connection exposing it through
+// a NetConn() method, such as *tls.Conn. It returns nil if the connection
+// doesn't come from a Listener or if it has no header, see Conn.ProxyHeader.
+func HeaderFromConn(conn net.Conn) *Header {
+	for conn != nil {
+		switch c := conn.(type) {
+		case *Conn:
+			return c.ProxyHeader()
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package proxyproto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestCertificate(t *testing.T, name string) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, roots
+}
+
+func TestTLSListener(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	// The certificate is picked from the destination port of the header
+	defaultCert, _ := newTestCertificate(t, "default.example.com")
+	proxiedCert, roots := newTestCertificate(t, "proxied.example.com")
+	config := &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			cert := defaultCert
+			if header := HeaderFromConn(hello.Conn); header != nil {
+				if _, destPort, ok := header.Ports(); ok && destPort == 8443 {
+					cert = proxiedCert
+				}
+			}
+			return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+		},
+	}
+
+	var policyCalled bool
+	pl := NewTLSListener(l, config, func(listener *Listener) {
+		listener.Policy = func(upstream net.Addr) (Policy, error) {
+			policyCalled = true
+			return REQUIRE, nil
+		}
+	})
+	defer pl.Close()
+
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 8443,
+		},
+	}
+
+	cliResult := make(chan error)
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			cliResult <- err
+			return
+		}
+		defer conn.Close()
+
+		if _, err := header.WriteTo(conn); err != nil {
+			cliResult <- err
+			return
+		}
+
+		// Fails unless the certificate for proxied.example.com is presented
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName: "proxied.example.com",
+			RootCAs:    roots,
+		})
+		if _, err := tlsConn.Write([]byte("ping")); err != nil {
+			cliResult <- err
+			return
+		}
+		recv := make([]byte, 4)
+		if _, err := io.ReadFull(tlsConn, recv); err != nil {
+			cliResult <- err
+			return
+		}
+		if string(recv) != "pong" {
+			cliResult <- fmt.Errorf("bad: %v", recv)
+			return
+		}
+		close(cliResult)
+	}()
+
+	conn, err := pl.Accept()
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	defer conn.Close()
+
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		t.Fatalf("expected a *tls.Conn, actual %T", conn)
+	}
+
+	recv := make([]byte, 4)
+	if _, err := io.ReadFull(tlsConn, recv); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if string(recv) != "ping" {
+		t.Fatalf("bad: %v", recv)
+	}
+	if _, err := tlsConn.Write([]byte("pong")); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if !policyCalled {
+		t.Fatalf("expected the listener options to be applied")
+	}
+	if tlsConn.RemoteAddr().String() != "10.1.1.1:1000" {
+		t.Fatalf("bad: %v", tlsConn.RemoteAddr())
+	}
+	if tlsConn.LocalAddr().String() != "20.2.2.2:8443" {
+		t.Fatalf("bad: %v", tlsConn.LocalAddr())
+	}
+	if tlsConn.ConnectionState().ServerName != "proxied.example.com" {
+		t.Fatalf("bad: %v", tlsConn.ConnectionState().ServerName)
+	}
+	if h := HeaderFromConn(tlsConn); !h.EqualsTo(header) {
+		t.Fatalf("expected %#v, actual %#v", header, h)
+	}
+
+	if err := <-cliResult; err != nil {
+		t.Fatalf("client error: %v", err)
+	}
+}
+
+func TestHeaderFromConnWithoutListener(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	if h := HeaderFromConn(server); h != nil {
+		t.Fatalf("expected no header, actual %#v", h)
+	}
+	if h := HeaderFromConn(tls.Server(server, &tls.Config{})); h != nil {
+		t.Fatalf("expected no header, actual %#v", h)
+	}
+	if h := HeaderFromConn(nil); h != nil {
+		t.Fatalf("expected no header, actual %#v", h)
+	}
+}
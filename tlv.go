@@ -54,7 +54,7 @@ func SplitTLVs(raw []byte) ([]TLV, error) {
 		tlv := TLV{
 			Type: PP2Type(raw[i]),
 		}
-		if len(raw)-i <= 3 {
+		if len(raw)-i < 3 {
 			return nil, ErrTruncatedTLV
 		}
 		tlv.Length = int(binary.BigEndian.Uint16(raw[i+1 : i+3])) // Max length = 65K
@@ -73,6 +73,48 @@ func SplitTLVs(raw []byte) ([]TLV, error) {
 	return tlvs, nil
 }
 
+// countTLVs returns the number of records in the Type-Length-Value vector,
+// without copying them. A truncated record counts as one.
+func countTLVs(raw []byte) int {
+	n := 0
+	for i := 0; i < len(raw); n++ {
+		if len(raw)-i < 3 {
+			return n + 1
+		}
+		i += 3 + int(binary.BigEndian.Uint16(raw[i+1:i+3]))
+	}
+	return n
+}
+
+// JoinTLVs joins multiple Type-Length-Value records into a single vector, the inverse of SplitTLVs.
+// A TLV with an empty Value and a non-zero Length, such as NOOP padding returned by SplitTLVs, is
+// written as Length zero bytes. It errors if a value exceeds the uint16 length limit.
+func JoinTLVs(tlvs []TLV) ([]byte, error) {
+	var raw []byte
+	for _, tlv := range tlvs {
+		length := len(tlv.Value)
+		if length == 0 {
+			length = tlv.Length
+		} else if tlv.Length != 0 && tlv.Length != length {
+			return nil, ErrMalformedTLV
+		}
+		if length < 0 || length >= 1<<16 {
+			return nil, errUint16Overflow
+		}
+
+		header := make([]byte, 3) // 1 = type + 2 = uint16 length
+		header[0] = byte(tlv.Type)
+		binary.BigEndian.PutUint16(header[1:3], uint16(length))
+		raw = append(raw, header...)
+		if len(tlv.Value) > 0 {
+			raw = append(raw, tlv.Value...)
+		} else {
+			raw = append(raw, make([]byte, length)...)
+		}
+	}
+	return raw, nil
+}
+
 // Registered is true if the type is registered in the spec, see section 2.2
 func (p PP2Type) Registered() bool {
 	switch p {
@@ -4,6 +4,8 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"net"
+	"reflect"
 	"testing"
 )
 
@@ -15,7 +17,7 @@ var (
 )
 
 func checkTLVs(t *testing.T, name string, raw []byte, expected []PP2Type) []TLV {
-	header, err := parseVersion2(bufio.NewReader(bytes.NewReader(raw)))
+	header, err := parseVersion2(bufio.NewReader(bytes.NewReader(raw)), ReadOptions{})
 	if err != nil {
 		t.Fatalf("%s: Unexpected error reading header %#v", name, err)
 	}
@@ -89,7 +91,7 @@ func TestInvalidV2TLV(t *testing.T) {
 }
 
 func TestV2TLVPP2Registered(t *testing.T) {
-	pp2RegTypes := []PP2Type {
+	pp2RegTypes := []PP2Type{
 		PP2_TYPE_ALPN, PP2_TYPE_AUTHORITY, PP2_TYPE_CRC32C, PP2_TYPE_NOOP,
 		PP2_TYPE_SSL, PP2_SUBTYPE_SSL_VERSION, PP2_SUBTYPE_SSL_CN,
 		PP2_SUBTYPE_SSL_CIPHER, PP2_SUBTYPE_SSL_SIG_ALG, PP2_SUBTYPE_SSL_KEY_ALG,
@@ -128,3 +130,159 @@ func TestV2TLVPP2Registered(t *testing.T) {
 		t.Fatalf("TestV2TLVPP2Registered: type %x unexpectedly registered", lastType)
 	}
 }
+
+func TestJoinTLVs(t *testing.T) {
+	tlvs := []TLV{
+		{Type: PP2_TYPE_ALPN, Value: []byte("h2")},
+		{Type: PP2_TYPE_AUTHORITY, Length: 11, Value: []byte("example.com")},
+		{Type: PP2_TYPE_MIN_CUSTOM, Value: []byte{}},
+		{Type: PP2_TYPE_NOOP, Length: 4},
+	}
+
+	raw, err := JoinTLVs(tlvs)
+	if err != nil {
+		t.Fatalf("TestJoinTLVs: unexpected error %#v", err)
+	}
+
+	expected := append(append(append(append([]byte{},
+		formatTLV(TLV{Type: PP2_TYPE_ALPN, Length: 2, Value: []byte("h2")})...),
+		formatTLV(TLV{Type: PP2_TYPE_AUTHORITY, Length: 11, Value: []byte("example.com")})...),
+		formatTLV(TLV{Type: PP2_TYPE_MIN_CUSTOM})...),
+		formatTLV(TLV{Type: PP2_TYPE_NOOP, Length: 4, Value: make([]byte, 4)})...)
+	if !bytes.Equal(raw, expected) {
+		t.Fatalf("TestJoinTLVs: expected %#v, actual %#v", expected, raw)
+	}
+
+	split, err := SplitTLVs(raw)
+	if err != nil {
+		t.Fatalf("TestJoinTLVs: unexpected error %#v", err)
+	}
+	rejoined, err := JoinTLVs(split)
+	if err != nil {
+		t.Fatalf("TestJoinTLVs: unexpected error %#v", err)
+	}
+	if !bytes.Equal(raw, rejoined) {
+		t.Fatalf("TestJoinTLVs: expected %#v, actual %#v", raw, rejoined)
+	}
+}
+
+func TestJoinTLVsRoundTripEmptyLastTLV(t *testing.T) {
+	for _, last := range []PP2Type{PP2_TYPE_MIN_CUSTOM + 1, PP2_TYPE_NOOP} {
+		tlvs := []TLV{
+			{Type: PP2_TYPE_ALPN, Value: []byte("h2")},
+			{Type: last},
+		}
+		raw, err := JoinTLVs(tlvs)
+		if err != nil {
+			t.Fatalf("TestJoinTLVsRoundTripEmptyLastTLV: unexpected error %#v", err)
+		}
+		split, err := SplitTLVs(raw)
+		if err != nil {
+			t.Fatalf("TestJoinTLVsRoundTripEmptyLastTLV: unexpected error %#v", err)
+		}
+		if len(split) != 2 || split[1].Type != last || split[1].Length != 0 || len(split[1].Value) != 0 {
+			t.Fatalf("TestJoinTLVsRoundTripEmptyLastTLV: unexpected TLVs %#v", split)
+		}
+
+		// The TLVs must also survive a header round trip
+		header := &Header{
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr:        &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+			DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("20.2.2.2"), Port: 2000},
+		}
+		if err := header.SetTLVs(tlvs); err != nil {
+			t.Fatalf("TestJoinTLVsRoundTripEmptyLastTLV: unexpected error %#v", err)
+		}
+		formatted, err := header.Format()
+		if err != nil {
+			t.Fatalf("TestJoinTLVsRoundTripEmptyLastTLV: unexpected error %#v", err)
+		}
+		received, err := Read(newBufioReader(formatted))
+		if err != nil {
+			t.Fatalf("TestJoinTLVsRoundTripEmptyLastTLV: unexpected error %#v", err)
+		}
+		if split, err := received.TLVs(); err != nil || len(split) != 2 || split[1].Type != last {
+			t.Fatalf("TestJoinTLVsRoundTripEmptyLastTLV: unexpected TLVs %#v, %v", split, err)
+		}
+	}
+}
+
+func TestJoinTLVsInvalid(t *testing.T) {
+	if _, err := JoinTLVs([]TLV{{Type: PP2_TYPE_MIN_CUSTOM, Value: make([]byte, 1<<16)}}); err != errUint16Overflow {
+		t.Fatalf("TestJoinTLVsInvalid: expected %#v, actual %#v", errUint16Overflow, err)
+	}
+	if _, err := JoinTLVs([]TLV{{Type: PP2_TYPE_MIN_CUSTOM, Length: 3, Value: []byte("ab")}}); err != ErrMalformedTLV {
+		t.Fatalf("TestJoinTLVsInvalid: expected %#v, actual %#v", ErrMalformedTLV, err)
+	}
+}
+
+func TestSetTLVsRoundTrip(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   v4addr,
+			Port: PORT,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   v4addr,
+			Port: PORT,
+		},
+	}
+	tlvs := []TLV{
+		{Type: PP2_TYPE_ALPN, Length: 2, Value: []byte("h2")},
+		{Type: PP2_TYPE_MIN_CUSTOM + 1, Length: 3, Value: []byte{1, 2, 3}},
+	}
+	if err := header.SetTLVs(tlvs); err != nil {
+		t.Fatalf("TestSetTLVsRoundTrip: unexpected error %#v", err)
+	}
+
+	var buf bytes.Buffer
+	if _, err := header.WriteTo(&buf); err != nil {
+		t.Fatalf("TestSetTLVsRoundTrip: unexpected error %#v", err)
+	}
+
+	newHeader, err := Read(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatalf("TestSetTLVsRoundTrip: unexpected error %#v", err)
+	}
+	if !newHeader.EqualsTo(header) {
+		t.Fatalf("TestSetTLVsRoundTrip: expected %#v, actual %#v", header, newHeader)
+	}
+
+	actual, err := newHeader.TLVs()
+	if err != nil {
+		t.Fatalf("TestSetTLVsRoundTrip: unexpected error %#v", err)
+	}
+	if !reflect.DeepEqual(actual, tlvs) {
+		t.Fatalf("TestSetTLVsRoundTrip: expected %#v, actual %#v", tlvs, actual)
+	}
+
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_MIN_CUSTOM, Value: make([]byte, 1<<16-4)}}); err != nil {
+		t.Fatalf("TestSetTLVsRoundTrip: unexpected error %#v", err)
+	}
+	if _, err := header.Format(); err != errUint16Overflow {
+		t.Fatalf("TestSetTLVsRoundTrip: expected %#v, actual %#v", errUint16Overflow, err)
+	}
+}
+
+func TestCountTLVs(t *testing.T) {
+	tests := []struct {
+		raw      []byte
+		expected int
+	}{
+		{nil, 0},
+		{[]byte{byte(PP2_TYPE_ALPN), 0x00, 0x02, 'h', '2'}, 1},
+		{[]byte{byte(PP2_TYPE_ALPN), 0x00, 0x02, 'h', '2', byte(PP2_TYPE_NOOP), 0x00, 0x00}, 2},
+		{[]byte{byte(PP2_TYPE_ALPN), 0x00, 0x02, 'h', '2', byte(PP2_TYPE_NOOP)}, 2},
+	}
+
+	for _, tt := range tests {
+		if n := countTLVs(tt.raw); n != tt.expected {
+			t.Fatalf("countTLVs(%v): expected %d, actual %d", tt.raw, tt.expected, n)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package tlvparse
+
+import (
+	"github.com/pires/go-proxyproto"
+)
+
+// maxALPNLen is the maximum length of an ALPN protocol name, see RFC 7301 section 3.1.
+const maxALPNLen = 255
+
+// IsALPN returns true if the TLV is type PP2_TYPE_ALPN.
+func IsALPN(t proxyproto.TLV) bool {
+	return t.Type == proxyproto.PP2_TYPE_ALPN
+}
+
+// ALPN returns the application protocol negotiated over the connection, e.g. "h2", from section 2.2.1
+// or errors with ErrIncompatibleTLV or ErrMalformedTLV.
+func ALPN(t proxyproto.TLV) ([]byte, error) {
+	if !IsALPN(t) {
+		return nil, proxyproto.ErrIncompatibleTLV
+	}
+	if len(t.Value) == 0 || len(t.Value) > maxALPNLen {
+		return nil, proxyproto.ErrMalformedTLV
+	}
+	return t.Value, nil
+}
+
+// FindALPN returns the first well-formed ALPN protocol if it exists in the TLV collection and a boolean
+// indicating if it was found.
+func FindALPN(tlvs []proxyproto.TLV) ([]byte, bool) {
+	for _, t := range tlvs {
+		if proto, err := ALPN(t); err == nil {
+			return proto, true
+		}
+	}
+	return nil, false
+}
+
+// ALPNTLV returns a PP2_TYPE_ALPN TLV carrying the given protocol or errors with ErrMalformedTLV if the
+// protocol is empty or longer than 255 bytes.
+func ALPNTLV(proto []byte) (proxyproto.TLV, error) {
+	if len(proto) == 0 || len(proto) > maxALPNLen {
+		return proxyproto.TLV{}, proxyproto.ErrMalformedTLV
+	}
+	value := make([]byte, len(proto))
+	copy(value, proto)
+	return proxyproto.TLV{
+		Type:   proxyproto.PP2_TYPE_ALPN,
+		Length: len(value),
+		Value:  value,
+	}, nil
+}
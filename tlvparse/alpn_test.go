@@ -0,0 +1,103 @@
+package tlvparse
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestFindALPN(t *testing.T) {
+	tests := []struct {
+		name      string
+		tlvs      []proxyproto.TLV
+		wantProto []byte
+		wantFound bool
+	}{
+		{
+			name:      "nil TLVs",
+			tlvs:      nil,
+			wantFound: false,
+		},
+		{
+			name: "authority only",
+			tlvs: []proxyproto.TLV{
+				{Type: proxyproto.PP2_TYPE_AUTHORITY, Length: 11, Value: []byte("example.com")},
+			},
+			wantFound: false,
+		},
+		{
+			name: "empty ALPN",
+			tlvs: []proxyproto.TLV{
+				{Type: proxyproto.PP2_TYPE_ALPN},
+			},
+			wantFound: false,
+		},
+		{
+			name: "ALPN",
+			tlvs: []proxyproto.TLV{
+				{Type: proxyproto.PP2_TYPE_AUTHORITY, Length: 11, Value: []byte("example.com")},
+				{Type: proxyproto.PP2_TYPE_ALPN, Length: 2, Value: []byte("h2")},
+			},
+			wantProto: []byte("h2"),
+			wantFound: true,
+		},
+		{
+			name: "first well-formed ALPN",
+			tlvs: []proxyproto.TLV{
+				{Type: proxyproto.PP2_TYPE_ALPN, Length: 256, Value: bytes.Repeat([]byte("a"), 256)},
+				{Type: proxyproto.PP2_TYPE_ALPN, Length: 8, Value: []byte("http/1.1")},
+			},
+			wantProto: []byte("http/1.1"),
+			wantFound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proto, found := FindALPN(tt.tlvs)
+			if found != tt.wantFound {
+				t.Fatalf("FindALPN() found = %v, want %v", found, tt.wantFound)
+			}
+			if !bytes.Equal(proto, tt.wantProto) {
+				t.Fatalf("FindALPN() proto = %q, want %q", proto, tt.wantProto)
+			}
+		})
+	}
+}
+
+func TestALPNTLV(t *testing.T) {
+	tlv, err := ALPNTLV([]byte("h2"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if tlv.Type != proxyproto.PP2_TYPE_ALPN || tlv.Length != 2 || string(tlv.Value) != "h2" {
+		t.Fatalf("Unexpected TLV %#v", tlv)
+	}
+
+	raw, err := proxyproto.JoinTLVs([]proxyproto.TLV{tlv})
+	if err != nil {
+		t.Fatalf("Unexpected error joining TLVs %v", err)
+	}
+	tlvs, err := proxyproto.SplitTLVs(raw)
+	if err != nil {
+		t.Fatalf("Unexpected error splitting TLVs %v", err)
+	}
+	if proto, found := FindALPN(tlvs); !found || string(proto) != "h2" {
+		t.Fatalf("Expected to find ALPN h2, actual %q", proto)
+	}
+
+	for _, proto := range [][]byte{nil, bytes.Repeat([]byte("a"), 256)} {
+		if _, err := ALPNTLV(proto); !errors.Is(err, proxyproto.ErrMalformedTLV) {
+			t.Fatalf("Expected ErrMalformedTLV for a %d bytes protocol, actual %v", len(proto), err)
+		}
+	}
+}
+
+func TestALPNIncompatibleTLV(t *testing.T) {
+	tlv := proxyproto.TLV{Type: proxyproto.PP2_TYPE_AUTHORITY, Length: 2, Value: []byte("h2")}
+	if _, err := ALPN(tlv); !errors.Is(err, proxyproto.ErrIncompatibleTLV) {
+		t.Fatalf("Expected ErrIncompatibleTLV, actual %v", err)
+	}
+}
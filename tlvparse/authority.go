@@ -0,0 +1,85 @@
+package tlvparse
+
+import (
+	"github.com/pires/go-proxyproto"
+)
+
+const (
+	// maxHostnameLen and maxLabelLen are the limits of a DNS host name, see RFC 1035 section 2.3.4.
+	maxHostnameLen = 253
+	maxLabelLen    = 63
+)
+
+// IsAuthority returns true if the TLV is type PP2_TYPE_AUTHORITY.
+func IsAuthority(t proxyproto.TLV) bool {
+	return t.Type == proxyproto.PP2_TYPE_AUTHORITY
+}
+
+// Authority returns the host name sent by the client, usually through the TLS SNI extension, from
+// section 2.2.2 or errors with ErrIncompatibleTLV or ErrMalformedTLV if it isn't a valid host name.
+func Authority(t proxyproto.TLV) (string, error) {
+	if !IsAuthority(t) {
+		return "", proxyproto.ErrIncompatibleTLV
+	}
+	host := string(t.Value)
+	if !isHostname(host) {
+		return "", proxyproto.ErrMalformedTLV
+	}
+	return host, nil
+}
+
+// FindAuthority returns the first well-formed authority if it exists in the TLV collection and a boolean
+// indicating if it was found.
+func FindAuthority(tlvs []proxyproto.TLV) (string, bool) {
+	for _, t := range tlvs {
+		if host, err := Authority(t); err == nil {
+			return host, true
+		}
+	}
+	return "", false
+}
+
+// AuthorityTLV returns a PP2_TYPE_AUTHORITY TLV carrying the given host name or errors with
+// ErrMalformedTLV if it isn't a valid host name.
+func AuthorityTLV(host string) (proxyproto.TLV, error) {
+	if !isHostname(host) {
+		return proxyproto.TLV{}, proxyproto.ErrMalformedTLV
+	}
+	return proxyproto.TLV{
+		Type:   proxyproto.PP2_TYPE_AUTHORITY,
+		Length: len(host),
+		Value:  []byte(host),
+	}, nil
+}
+
+// isHostname checks whether host is a host name as sent in the TLS SNI extension: dot-separated labels
+// of letters, digits and hyphens, which don't start or end with a hyphen, and no trailing dot.
+func isHostname(host string) bool {
+	if len(host) == 0 || len(host) > maxHostnameLen {
+		return false
+	}
+	labelLen := 0
+	for i := 0; i < len(host); i++ {
+		c := host[i]
+		switch {
+		case c == '.':
+			if labelLen == 0 || host[i-1] == '-' {
+				return false
+			}
+			labelLen = 0
+			continue
+		case c == '-':
+			if labelLen == 0 {
+				return false
+			}
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		default:
+			return false
+		}
+		labelLen++
+		if labelLen > maxLabelLen {
+			return false
+		}
+	}
+	return labelLen > 0 && host[len(host)-1] != '-'
+}
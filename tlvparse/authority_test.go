@@ -0,0 +1,131 @@
+package tlvparse
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func TestFindAuthority(t *testing.T) {
+	tests := []struct {
+		name      string
+		tlvs      []proxyproto.TLV
+		wantHost  string
+		wantFound bool
+	}{
+		{
+			name:      "nil TLVs",
+			tlvs:      nil,
+			wantFound: false,
+		},
+		{
+			name: "ALPN only",
+			tlvs: []proxyproto.TLV{
+				{Type: proxyproto.PP2_TYPE_ALPN, Length: 2, Value: []byte("h2")},
+			},
+			wantFound: false,
+		},
+		{
+			name: "authority",
+			tlvs: []proxyproto.TLV{
+				{Type: proxyproto.PP2_TYPE_ALPN, Length: 2, Value: []byte("h2")},
+				{Type: proxyproto.PP2_TYPE_AUTHORITY, Length: 15, Value: []byte("www.Example.com")},
+			},
+			wantHost:  "www.Example.com",
+			wantFound: true,
+		},
+		{
+			name: "first well-formed authority",
+			tlvs: []proxyproto.TLV{
+				{Type: proxyproto.PP2_TYPE_AUTHORITY, Length: 12, Value: []byte("example.com.")},
+				{Type: proxyproto.PP2_TYPE_AUTHORITY, Length: 11, Value: []byte("example.org")},
+			},
+			wantHost:  "example.org",
+			wantFound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, found := FindAuthority(tt.tlvs)
+			if found != tt.wantFound {
+				t.Fatalf("FindAuthority() found = %v, want %v", found, tt.wantFound)
+			}
+			if host != tt.wantHost {
+				t.Fatalf("FindAuthority() host = %q, want %q", host, tt.wantHost)
+			}
+		})
+	}
+}
+
+func TestAuthorityHostnameValidation(t *testing.T) {
+	label := strings.Repeat("a", 63)
+	tests := []struct {
+		host  string
+		valid bool
+	}{
+		{"localhost", true},
+		{"example.com", true},
+		{"xn--bcher-kva.example", true},
+		{"1.example.com", true},
+		{"my-host.example.com", true},
+		{label + ".com", true},
+		{strings.Repeat(label+".", 3) + strings.Repeat("a", 61), true},
+		{"", false},
+		{".", false},
+		{"example.com.", false},
+		{".example.com", false},
+		{"example..com", false},
+		{"-example.com", false},
+		{"example-.com", false},
+		{"example.com-", false},
+		{"exa_mple.com", false},
+		{"exa mple.com", false},
+		{"example.com:443", false},
+		{"bücher.example", false},
+		{label + "a.com", false},
+		{strings.Repeat(label+".", 3) + strings.Repeat("a", 62), false},
+	}
+
+	for _, tt := range tests {
+		tlv := proxyproto.TLV{Type: proxyproto.PP2_TYPE_AUTHORITY, Length: len(tt.host), Value: []byte(tt.host)}
+		host, err := Authority(tlv)
+		if tt.valid && (err != nil || host != tt.host) {
+			t.Fatalf("Expected %q to be valid, actual %q, %v", tt.host, host, err)
+		}
+		if !tt.valid && !errors.Is(err, proxyproto.ErrMalformedTLV) {
+			t.Fatalf("Expected ErrMalformedTLV for %q, actual %v", tt.host, err)
+		}
+		if _, err := AuthorityTLV(tt.host); (err == nil) != tt.valid {
+			t.Fatalf("Unexpected AuthorityTLV error for %q: %v", tt.host, err)
+		}
+	}
+}
+
+func TestAuthorityTLV(t *testing.T) {
+	tlv, err := AuthorityTLV("example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if tlv.Type != proxyproto.PP2_TYPE_AUTHORITY || tlv.Length != 11 || string(tlv.Value) != "example.com" {
+		t.Fatalf("Unexpected TLV %#v", tlv)
+	}
+
+	raw, err := proxyproto.JoinTLVs([]proxyproto.TLV{tlv})
+	if err != nil {
+		t.Fatalf("Unexpected error joining TLVs %v", err)
+	}
+	tlvs, err := proxyproto.SplitTLVs(raw)
+	if err != nil {
+		t.Fatalf("Unexpected error splitting TLVs %v", err)
+	}
+	if host, found := FindAuthority(tlvs); !found || host != "example.com" {
+		t.Fatalf("Expected to find authority example.com, actual %q", host)
+	}
+
+	if _, err := Authority(proxyproto.TLV{Type: proxyproto.PP2_TYPE_ALPN, Length: 2, Value: []byte("h2")}); !errors.Is(err, proxyproto.ErrIncompatibleTLV) {
+		t.Fatalf("Expected ErrIncompatibleTLV, actual %v", err)
+	}
+}
@@ -4,6 +4,7 @@
 package tlvparse
 
 import (
+	"errors"
 	"regexp"
 
 	"github.com/pires/go-proxyproto"
@@ -17,6 +18,8 @@ const (
 
 var	vpceRe = regexp.MustCompile("^[A-Za-z0-9-]*$")
 
+var ErrAWSVPCEndpointIDNotAllowed = errors.New("AWS VPC endpoint ID not allowed")
+
 func IsAWSVPCEndpointID(tlv proxyproto.TLV) bool {
 	return tlv.Type == PP2_TYPE_AWS && tlv.Length >= 1 && tlv.Value[0] == PP2_SUBTYPE_AWS_VPCE_ID
 }
@@ -41,3 +44,25 @@ func FindAWSVPCEndpointID(tlvs []proxyproto.TLV) string {
 	}
 	return ""
 }
+
+// AllowAWSVPCEndpointIDs returns a proxyproto.Validator which rejects headers
+// whose AWS VPC endpoint ID is missing or isn't one of the allowed ones.
+// LOCAL headers are accepted, as they don't carry a proxied connection.
+func AllowAWSVPCEndpointIDs(allowed ...string) proxyproto.Validator {
+	return func(header *proxyproto.Header) error {
+		if header.Command.IsLocal() {
+			return nil
+		}
+		tlvs, err := header.TLVs()
+		if err != nil {
+			return err
+		}
+		vpce := FindAWSVPCEndpointID(tlvs)
+		for _, allowedID := range allowed {
+			if vpce != "" && vpce == allowedID {
+				return nil
+			}
+		}
+		return ErrAWSVPCEndpointIDNotAllowed
+	}
+}
@@ -1,6 +1,8 @@
 package tlvparse
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
 	"github.com/pires/go-proxyproto"
 	"testing"
@@ -232,3 +234,49 @@ func vpceTLV(vpce string) []byte {
 	binary.BigEndian.PutUint16(tlv[1:3], uint16(len(vpce) + 1)) // +1 for subtype
 	return append(tlv, []byte(vpce)...)
 }
+
+func TestAWSVPCEndpointCRC32C(t *testing.T) {
+	tc := awsTestCases[0]
+	header, err := proxyproto.Read(bufio.NewReader(bytes.NewReader(tc.raw)))
+	if err != nil {
+		t.Fatalf("TestAWSVPCEndpointCRC32C %s: Unexpected error reading header %#v", tc.name, err)
+	}
+	if err := proxyproto.ValidateCRC32C(header); err != nil {
+		t.Fatalf("TestAWSVPCEndpointCRC32C %s: Unexpected error validating checksum %#v", tc.name, err)
+	}
+
+	corrupted := append([]byte{}, tc.raw...)
+	corrupted[len(corrupted)-1] = 0xFF
+	header, err = proxyproto.Read(bufio.NewReader(bytes.NewReader(corrupted)))
+	if err != nil {
+		t.Fatalf("TestAWSVPCEndpointCRC32C %s: Unexpected error reading header %#v", tc.name, err)
+	}
+	if err := proxyproto.ValidateCRC32C(header); err != proxyproto.ErrInvalidChecksum {
+		t.Fatalf("TestAWSVPCEndpointCRC32C %s: Expected %#v, actual %#v", tc.name, proxyproto.ErrInvalidChecksum, err)
+	}
+}
+
+func TestAllowAWSVPCEndpointIDs(t *testing.T) {
+	tc := awsTestCases[0]
+	header, err := proxyproto.Read(bufio.NewReader(bytes.NewReader(tc.raw)))
+	if err != nil {
+		t.Fatalf("TestAllowAWSVPCEndpointIDs %s: Unexpected error reading header %#v", tc.name, err)
+	}
+
+	if err := AllowAWSVPCEndpointIDs("vpce-0123", "vpce-08d2bf15fac5001c9")(header); err != nil {
+		t.Fatalf("TestAllowAWSVPCEndpointIDs %s: Unexpected error %#v", tc.name, err)
+	}
+	if err := AllowAWSVPCEndpointIDs("vpce-0123")(header); err != ErrAWSVPCEndpointIDNotAllowed {
+		t.Fatalf("TestAllowAWSVPCEndpointIDs %s: Expected %#v, actual %#v", tc.name, ErrAWSVPCEndpointIDNotAllowed, err)
+	}
+
+	withoutTLVs := proxyproto.HeaderProxyFromAddrs(2, header.SourceAddr, header.DestinationAddr)
+	if err := AllowAWSVPCEndpointIDs("")(withoutTLVs); err != ErrAWSVPCEndpointIDNotAllowed {
+		t.Fatalf("TestAllowAWSVPCEndpointIDs: Expected %#v for a header without TLVs, actual %#v", ErrAWSVPCEndpointIDNotAllowed, err)
+	}
+
+	local := &proxyproto.Header{Version: 2, Command: proxyproto.LOCAL, TransportProtocol: proxyproto.UNSPEC}
+	if err := AllowAWSVPCEndpointIDs()(local); err != nil {
+		t.Fatalf("TestAllowAWSVPCEndpointIDs: Unexpected error for a LOCAL header %#v", err)
+	}
+}
@@ -57,25 +57,69 @@ func (s PP2SSL) ClientCertSess() bool {
 
 // SSLVersion returns the US-ASCII string representation of the TLS version and whether that extension exists.
 func (s PP2SSL) SSLVersion() (string, bool) {
-	for _, tlv := range s.TLV {
-		if tlv.Type == proxyproto.PP2_SUBTYPE_SSL_VERSION {
-			return string(tlv.Value), true
-		}
-	}
-	return "", false
+	return s.subTLV(proxyproto.PP2_SUBTYPE_SSL_VERSION)
 }
 
 // ClientCN returns the string representation (in UTF8) of the Common Name field (OID: 2.5.4.3) of the client
 // certificate's Distinguished Name and whether that extension exists.
 func (s PP2SSL) ClientCN() (string, bool) {
+	return s.subTLV(proxyproto.PP2_SUBTYPE_SSL_CN)
+}
+
+// Cipher returns the US-ASCII string name of the used cipher, e.g. "ECDHE-RSA-AES128-GCM-SHA256", and whether
+// that extension exists.
+func (s PP2SSL) Cipher() (string, bool) {
+	return s.subTLV(proxyproto.PP2_SUBTYPE_SSL_CIPHER)
+}
+
+// SigAlg returns the US-ASCII string name of the algorithm used to sign the certificate presented by the
+// frontend, e.g. "RSA-SHA256", and whether that extension exists.
+func (s PP2SSL) SigAlg() (string, bool) {
+	return s.subTLV(proxyproto.PP2_SUBTYPE_SSL_SIG_ALG)
+}
+
+// KeyAlg returns the US-ASCII string name of the algorithm used to generate the key of the certificate
+// presented by the frontend, e.g. "RSA2048", and whether that extension exists.
+func (s PP2SSL) KeyAlg() (string, bool) {
+	return s.subTLV(proxyproto.PP2_SUBTYPE_SSL_KEY_ALG)
+}
+
+// subTLV returns the value of the first sub-TLV of the given type and whether it exists.
+func (s PP2SSL) subTLV(t proxyproto.PP2Type) (string, bool) {
 	for _, tlv := range s.TLV {
-		if tlv.Type == proxyproto.PP2_SUBTYPE_SSL_CN {
+		if tlv.Type == t {
 			return string(tlv.Value), true
 		}
 	}
 	return "", false
 }
 
+// Marshal returns the pp2_tlv_ssl from section 2.2.5 as a PP2_TYPE_SSL TLV, with the sub-TLVs nested in its
+// value. It errors with ErrMalformedTLV if the result wouldn't be accepted by SSL.
+func (s PP2SSL) Marshal() (proxyproto.TLV, error) {
+	subTLVs, err := proxyproto.JoinTLVs(s.TLV)
+	if err != nil {
+		return proxyproto.TLV{}, err
+	}
+	value := make([]byte, tlvSSLMinLen, tlvSSLMinLen+len(subTLVs))
+	value[0] = s.Client
+	binary.BigEndian.PutUint32(value[1:5], s.Verify)
+	value = append(value, subTLVs...)
+	if len(value) >= 1<<16 {
+		return proxyproto.TLV{}, proxyproto.ErrMalformedTLV
+	}
+
+	t := proxyproto.TLV{
+		Type:   proxyproto.PP2_TYPE_SSL,
+		Length: len(value),
+		Value:  value,
+	}
+	if _, err := SSL(t); err != nil {
+		return proxyproto.TLV{}, err
+	}
+	return t, nil
+}
+
 // SSLType is true if the TLV is type SSL
 func IsSSL(t proxyproto.TLV) bool {
 	return t.Type == proxyproto.PP2_TYPE_SSL && t.Length >= tlvSSLMinLen
@@ -99,7 +143,6 @@ func SSL(t proxyproto.TLV) (PP2SSL, error) {
 		return PP2SSL{}, err
 	}
 	versionFound := !ssl.ClientSSL()
-	var cnFound bool
 	for _, tlv := range ssl.TLV {
 		switch tlv.Type {
 		case proxyproto.PP2_SUBTYPE_SSL_VERSION:
@@ -119,13 +162,23 @@ func SSL(t proxyproto.TLV) (PP2SSL, error) {
 				(OID: 2.5.4.3) of the client certificate's Distinguished Name, is appended
 				using the TLV format and the type PP2_SUBTYPE_SSL_CN. E.g. "example.com".
 			*/
+			// Clients without a certificate don't have a Common Name, so it is optional.
 			if tlv.Length == 0 || !utf8.Valid(tlv.Value) {
 				return PP2SSL{}, proxyproto.ErrMalformedTLV
 			}
-			cnFound = true
+		case proxyproto.PP2_SUBTYPE_SSL_CIPHER, proxyproto.PP2_SUBTYPE_SSL_SIG_ALG, proxyproto.PP2_SUBTYPE_SSL_KEY_ALG:
+			/*
+				The second level TLVs PP2_SUBTYPE_SSL_CIPHER, PP2_SUBTYPE_SSL_SIG_ALG and
+				PP2_SUBTYPE_SSL_KEY_ALG provide the US-ASCII string name of the used cipher,
+				of the algorithm used to sign the certificate and of the algorithm used to
+				generate the key of the certificate.
+			*/
+			if tlv.Length == 0 || !isASCII(tlv.Value) {
+				return PP2SSL{}, proxyproto.ErrMalformedTLV
+			}
 		}
 	}
-	if !(versionFound && cnFound) {
+	if !versionFound {
 		return PP2SSL{}, proxyproto.ErrMalformedTLV
 	}
 	return ssl, nil
@@ -1,6 +1,7 @@
 package tlvparse
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/pires/go-proxyproto"
@@ -89,3 +90,154 @@ func TestParseV2TLV(t *testing.T) {
 	}
 }
 
+func TestSSLAccessors(t *testing.T) {
+	ssl := PP2SSL{
+		Client: PP2_BITFIELD_CLIENT_SSL,
+		TLV: []proxyproto.TLV{
+			stringTLV(proxyproto.PP2_SUBTYPE_SSL_VERSION, "TLSv1.2"),
+			stringTLV(proxyproto.PP2_SUBTYPE_SSL_CIPHER, "ECDHE-RSA-AES128-GCM-SHA256"),
+			stringTLV(proxyproto.PP2_SUBTYPE_SSL_SIG_ALG, "RSA-SHA256"),
+			stringTLV(proxyproto.PP2_SUBTYPE_SSL_KEY_ALG, "RSA2048"),
+		},
+	}
+
+	tests := []struct {
+		name     string
+		accessor func() (string, bool)
+		expected string
+	}{
+		{"SSLVersion", ssl.SSLVersion, "TLSv1.2"},
+		{"Cipher", ssl.Cipher, "ECDHE-RSA-AES128-GCM-SHA256"},
+		{"SigAlg", ssl.SigAlg, "RSA-SHA256"},
+		{"KeyAlg", ssl.KeyAlg, "RSA2048"},
+	}
+	for _, tt := range tests {
+		if actual, ok := tt.accessor(); !ok || actual != tt.expected {
+			t.Fatalf("%s: expected %q, actual %q (found %v)", tt.name, tt.expected, actual, ok)
+		}
+	}
+	if cn, ok := ssl.ClientCN(); ok {
+		t.Fatalf("Expected no ClientCN, actual %q", cn)
+	}
+}
+
+func TestSSLMarshal(t *testing.T) {
+	ssl := PP2SSL{
+		Client: PP2_BITFIELD_CLIENT_SSL | PP2_BITFIELD_CLIENT_CERT_CONN | PP2_BITFIELD_CLIENT_CERT_SESS,
+		Verify: 0,
+		TLV: []proxyproto.TLV{
+			stringTLV(proxyproto.PP2_SUBTYPE_SSL_VERSION, "TLSv1.3"),
+			stringTLV(proxyproto.PP2_SUBTYPE_SSL_CN, "Example Common Name Client Cert"),
+		},
+	}
+
+	tlv, err := ssl.Marshal()
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// Same TLV as sent by haproxy in the "SSL haproxy cn" test case
+	expected := testCases[0].raw[28:]
+	raw, err := proxyproto.JoinTLVs([]proxyproto.TLV{tlv})
+	if err != nil {
+		t.Fatalf("Unexpected error joining TLVs %v", err)
+	}
+	if string(raw) != string(expected) {
+		t.Fatalf("Expected %#v, actual %#v", expected, raw)
+	}
+
+	parsed, err := SSL(tlv)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing marshaled TLV %v", err)
+	}
+	if parsed.Client != ssl.Client || parsed.Verify != ssl.Verify || len(parsed.TLV) != len(ssl.TLV) {
+		t.Fatalf("Expected %#v, actual %#v", ssl, parsed)
+	}
+}
+
+func TestSSLMarshalInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		ssl  PP2SSL
+	}{
+		{
+			name: "missing version",
+			ssl:  PP2SSL{Client: PP2_BITFIELD_CLIENT_SSL},
+		},
+		{
+			name: "empty CN",
+			ssl: PP2SSL{TLV: []proxyproto.TLV{
+				stringTLV(proxyproto.PP2_SUBTYPE_SSL_CN, ""),
+				stringTLV(proxyproto.PP2_SUBTYPE_SSL_KEY_ALG, "RSA2048"),
+			}},
+		},
+		{
+			name: "non-ASCII cipher",
+			ssl: PP2SSL{TLV: []proxyproto.TLV{
+				stringTLV(proxyproto.PP2_SUBTYPE_SSL_CIPHER, "AES\u00e9"),
+			}},
+		},
+		{
+			name: "mismatched sub-TLV length",
+			ssl: PP2SSL{TLV: []proxyproto.TLV{
+				{Type: proxyproto.PP2_SUBTYPE_SSL_SIG_ALG, Length: 3, Value: []byte("SHA256")},
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.ssl.Marshal(); !errors.Is(err, proxyproto.ErrMalformedTLV) {
+				t.Fatalf("Expected ErrMalformedTLV, actual %v", err)
+			}
+		})
+	}
+}
+
+func TestSSLWithoutClientCertificate(t *testing.T) {
+	tests := []struct {
+		name string
+		ssl  PP2SSL
+	}{
+		{
+			name: "plain connection",
+			ssl:  PP2SSL{Verify: 1},
+		},
+		{
+			name: "no client certificate",
+			ssl: PP2SSL{
+				Client: PP2_BITFIELD_CLIENT_SSL,
+				Verify: 1,
+				TLV: []proxyproto.TLV{
+					stringTLV(proxyproto.PP2_SUBTYPE_SSL_VERSION, "TLSv1.3"),
+					stringTLV(proxyproto.PP2_SUBTYPE_SSL_CIPHER, "TLS_AES_128_GCM_SHA256"),
+				},
+			},
+		},
+		{
+			name: "client certificate without CN",
+			ssl: PP2SSL{
+				Client: PP2_BITFIELD_CLIENT_SSL | PP2_BITFIELD_CLIENT_CERT_CONN,
+				TLV: []proxyproto.TLV{
+					stringTLV(proxyproto.PP2_SUBTYPE_SSL_VERSION, "TLSv1.2"),
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlv, err := tt.ssl.Marshal()
+			if err != nil {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			ssl, found := FindSSL([]proxyproto.TLV{tlv})
+			if !found {
+				t.Fatalf("Expected to find the SSL TLV")
+			}
+			if cn, ok := ssl.ClientCN(); ok {
+				t.Fatalf("Expected no ClientCN, actual %q", cn)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+package tlvparse
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// tlsVersionNames are the TLS version names as sent by haproxy, which uses those of OpenSSL.
+var tlsVersionNames = map[uint16]string{
+	tls.VersionSSL30: "SSLv3",
+	tls.VersionTLS10: "TLSv1",
+	tls.VersionTLS11: "TLSv1.1",
+	tls.VersionTLS12: "TLSv1.2",
+	tls.VersionTLS13: "TLSv1.3",
+}
+
+// cipherSuiteNames are the OpenSSL names of the cipher suites supported by crypto/tls. The names of the
+// TLS 1.3 cipher suites are the same in OpenSSL and in crypto/tls.
+var cipherSuiteNames = map[uint16]string{
+	tls.TLS_RSA_WITH_RC4_128_SHA:                      "RC4-SHA",
+	tls.TLS_RSA_WITH_3DES_EDE_CBC_SHA:                 "DES-CBC3-SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA:                  "AES128-SHA",
+	tls.TLS_RSA_WITH_AES_256_CBC_SHA:                  "AES256-SHA",
+	tls.TLS_RSA_WITH_AES_128_CBC_SHA256:               "AES128-SHA256",
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256:               "AES128-GCM-SHA256",
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384:               "AES256-GCM-SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_RC4_128_SHA:              "ECDHE-ECDSA-RC4-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA:          "ECDHE-ECDSA-AES128-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_CBC_SHA:          "ECDHE-ECDSA-AES256-SHA",
+	tls.TLS_ECDHE_RSA_WITH_RC4_128_SHA:                "ECDHE-RSA-RC4-SHA",
+	tls.TLS_ECDHE_RSA_WITH_3DES_EDE_CBC_SHA:           "ECDHE-RSA-DES-CBC3-SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA:            "ECDHE-RSA-AES128-SHA",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_CBC_SHA:            "ECDHE-RSA-AES256-SHA",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_CBC_SHA256:       "ECDHE-ECDSA-AES128-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256:         "ECDHE-RSA-AES128-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:         "ECDHE-RSA-AES128-GCM-SHA256",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256:       "ECDHE-ECDSA-AES128-GCM-SHA256",
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384:         "ECDHE-RSA-AES256-GCM-SHA384",
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384:       "ECDHE-ECDSA-AES256-GCM-SHA384",
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256:   "ECDHE-RSA-CHACHA20-POLY1305",
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256: "ECDHE-ECDSA-CHACHA20-POLY1305",
+	tls.TLS_AES_128_GCM_SHA256:                        "TLS_AES_128_GCM_SHA256",
+	tls.TLS_AES_256_GCM_SHA384:                        "TLS_AES_256_GCM_SHA384",
+	tls.TLS_CHACHA20_POLY1305_SHA256:                  "TLS_CHACHA20_POLY1305_SHA256",
+}
+
+// signatureAlgorithmNames are the OpenSSL short names of the certificate signature algorithms.
+var signatureAlgorithmNames = map[x509.SignatureAlgorithm]string{
+	x509.MD2WithRSA:       "RSA-MD2",
+	x509.MD5WithRSA:       "RSA-MD5",
+	x509.SHA1WithRSA:      "RSA-SHA1",
+	x509.SHA256WithRSA:    "RSA-SHA256",
+	x509.SHA384WithRSA:    "RSA-SHA384",
+	x509.SHA512WithRSA:    "RSA-SHA512",
+	x509.DSAWithSHA1:      "DSA-SHA1",
+	x509.DSAWithSHA256:    "dsa_with_SHA256",
+	x509.ECDSAWithSHA1:    "ecdsa-with-SHA1",
+	x509.ECDSAWithSHA256:  "ecdsa-with-SHA256",
+	x509.ECDSAWithSHA384:  "ecdsa-with-SHA384",
+	x509.ECDSAWithSHA512:  "ecdsa-with-SHA512",
+	x509.SHA256WithRSAPSS: "RSASSA-PSS",
+	x509.SHA384WithRSAPSS: "RSASSA-PSS",
+	x509.SHA512WithRSAPSS: "RSASSA-PSS",
+	x509.PureEd25519:      "ED25519",
+}
+
+// SSLFromConnectionState returns the PP2_TYPE_SSL TLV describing a TLS connection accepted by a crypto/tls
+// server, with the same sub-TLVs as haproxy. The client certificate bits and the verify field tell whether
+// the client presented a certificate and whether it was verified, while the sub-TLVs carry the TLS version,
+// the cipher suite and, if the client presented a certificate, its Common Name.
+//
+// The signature and key algorithms sub-TLVs describe the certificate presented by the server, which
+// crypto/tls doesn't expose in the connection state. They are taken from local, and omitted if it is nil.
+func SSLFromConnectionState(state tls.ConnectionState, local *x509.Certificate) (proxyproto.TLV, error) {
+	ssl := PP2SSL{Verify: 1}
+	if !state.HandshakeComplete {
+		return ssl.Marshal()
+	}
+
+	version, ok := tlsVersionNames[state.Version]
+	if !ok {
+		return proxyproto.TLV{}, fmt.Errorf("unknown TLS version 0x%04x", state.Version)
+	}
+	cipher, ok := cipherSuiteNames[state.CipherSuite]
+	if !ok {
+		cipher = tls.CipherSuiteName(state.CipherSuite)
+	}
+	ssl.Client = PP2_BITFIELD_CLIENT_SSL
+	ssl.TLV = append(ssl.TLV,
+		stringTLV(proxyproto.PP2_SUBTYPE_SSL_VERSION, version),
+		stringTLV(proxyproto.PP2_SUBTYPE_SSL_CIPHER, cipher),
+	)
+
+	if len(state.PeerCertificates) > 0 {
+		// Resumed sessions carry the certificate presented on the initial connection
+		ssl.Client |= PP2_BITFIELD_CLIENT_CERT_SESS
+		if !state.DidResume {
+			ssl.Client |= PP2_BITFIELD_CLIENT_CERT_CONN
+		}
+		if len(state.VerifiedChains) > 0 {
+			ssl.Verify = 0
+		}
+		if cn := state.PeerCertificates[0].Subject.CommonName; cn != "" {
+			ssl.TLV = append(ssl.TLV, stringTLV(proxyproto.PP2_SUBTYPE_SSL_CN, cn))
+		}
+	}
+
+	if local != nil {
+		if sigAlg, ok := signatureAlgorithmNames[local.SignatureAlgorithm]; ok {
+			ssl.TLV = append(ssl.TLV, stringTLV(proxyproto.PP2_SUBTYPE_SSL_SIG_ALG, sigAlg))
+		}
+		if keyAlg := keyAlgorithm(local); keyAlg != "" {
+			ssl.TLV = append(ssl.TLV, stringTLV(proxyproto.PP2_SUBTYPE_SSL_KEY_ALG, keyAlg))
+		}
+	}
+
+	return ssl.Marshal()
+}
+
+// TLVsFromConnectionState returns the TLVs describing a TLS connection accepted by a crypto/tls server: the
+// PP2_TYPE_SSL TLV from SSLFromConnectionState, followed by the PP2_TYPE_ALPN TLV if a protocol was negotiated
+// and the PP2_TYPE_AUTHORITY TLV if the client sent a valid host name through SNI.
+func TLVsFromConnectionState(state tls.ConnectionState, local *x509.Certificate) ([]proxyproto.TLV, error) {
+	ssl, err := SSLFromConnectionState(state, local)
+	if err != nil {
+		return nil, err
+	}
+	tlvs := []proxyproto.TLV{ssl}
+
+	if state.NegotiatedProtocol != "" {
+		alpn, err := ALPNTLV([]byte(state.NegotiatedProtocol))
+		if err != nil {
+			return nil, err
+		}
+		tlvs = append(tlvs, alpn)
+	}
+	if authority, err := AuthorityTLV(state.ServerName); err == nil {
+		tlvs = append(tlvs, authority)
+	}
+
+	return tlvs, nil
+}
+
+// keyAlgorithm returns the algorithm and size of the certificate key as named by haproxy, e.g. "RSA2048" or
+// "EC256".
+func keyAlgorithm(cert *x509.Certificate) string {
+	switch key := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA%d", key.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("EC%d", key.Curve.Params().BitSize)
+	}
+	switch cert.PublicKeyAlgorithm {
+	case x509.Ed25519:
+		return "ED25519"
+	case x509.UnknownPublicKeyAlgorithm:
+		return ""
+	}
+	return cert.PublicKeyAlgorithm.String()
+}
+
+func stringTLV(t proxyproto.PP2Type, value string) proxyproto.TLV {
+	return proxyproto.TLV{Type: t, Length: len(value), Value: []byte(value)}
+}
@@ -0,0 +1,216 @@
+package tlvparse
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+)
+
+func newTestCertificate(t *testing.T, cn string, key crypto.Signer) (tls.Certificate, *x509.Certificate) {
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		DNSNames:              []string{cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("Unexpected error creating certificate %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing certificate %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}, cert
+}
+
+// handshake runs a TLS handshake over an in-memory connection and returns the server connection state.
+func handshake(t *testing.T, serverConfig, clientConfig *tls.Config) tls.ConnectionState {
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- tls.Client(clientConn, clientConfig).Handshake()
+	}()
+
+	server := tls.Server(serverConn, serverConfig)
+	if err := server.Handshake(); err != nil {
+		t.Fatalf("Unexpected server handshake error %v", err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("Unexpected client handshake error %v", err)
+	}
+	return server.ConnectionState()
+}
+
+func newECDSAKey(t *testing.T) crypto.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Unexpected error generating key %v", err)
+	}
+	return key
+}
+
+func TestTLVsFromConnectionState(t *testing.T) {
+	// The client key differs from the server one, whose algorithms must be sent
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Unexpected error generating key %v", err)
+	}
+	serverCert, serverLeaf := newTestCertificate(t, "example.com", newECDSAKey(t))
+	clientCert, clientLeaf := newTestCertificate(t, "Example Client", clientKey)
+	roots := x509.NewCertPool()
+	roots.AddCert(serverLeaf)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientLeaf)
+
+	state := handshake(t,
+		&tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    clientCAs,
+			NextProtos:   []string{"h2", "http/1.1"},
+			MinVersion:   tls.VersionTLS12,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		},
+		&tls.Config{
+			Certificates: []tls.Certificate{clientCert},
+			RootCAs:      roots,
+			ServerName:   "example.com",
+			NextProtos:   []string{"h2"},
+		},
+	)
+
+	tlvs, err := TLVsFromConnectionState(state, serverLeaf)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+
+	// The TLVs must survive a round trip through a header
+	header := &proxyproto.Header{
+		Version:           2,
+		Command:           proxyproto.PROXY,
+		TransportProtocol: proxyproto.TCPv4,
+		SourceAddr:        &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000},
+		DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("20.2.2.2"), Port: 443},
+	}
+	if err := header.SetTLVs(tlvs); err != nil {
+		t.Fatalf("Unexpected error setting TLVs %v", err)
+	}
+	raw, err := header.Format()
+	if err != nil {
+		t.Fatalf("Unexpected error formatting header %v", err)
+	}
+	tlvs = checkTLVs(t, "TLVsFromConnectionState", raw, []proxyproto.PP2Type{
+		proxyproto.PP2_TYPE_SSL, proxyproto.PP2_TYPE_ALPN, proxyproto.PP2_TYPE_AUTHORITY,
+	})
+
+	ssl, found := FindSSL(tlvs)
+	if !found {
+		t.Fatalf("Expected to find the SSL TLV")
+	}
+	if !ssl.ClientSSL() || !ssl.ClientCertConn() || !ssl.ClientCertSess() || !ssl.Verified() {
+		t.Fatalf("Unexpected client bits %#x and verify %d", ssl.Client, ssl.Verify)
+	}
+	expected := []struct {
+		name     string
+		accessor func() (string, bool)
+		value    string
+	}{
+		{"SSLVersion", ssl.SSLVersion, "TLSv1.2"},
+		{"Cipher", ssl.Cipher, "ECDHE-ECDSA-AES128-GCM-SHA256"},
+		{"ClientCN", ssl.ClientCN, "Example Client"},
+		{"SigAlg", ssl.SigAlg, "ecdsa-with-SHA256"},
+		{"KeyAlg", ssl.KeyAlg, "EC256"},
+	}
+	for _, e := range expected {
+		if actual, ok := e.accessor(); !ok || actual != e.value {
+			t.Fatalf("%s: expected %q, actual %q (found %v)", e.name, e.value, actual, ok)
+		}
+	}
+
+	if alpn, found := FindALPN(tlvs); !found || string(alpn) != "h2" {
+		t.Fatalf("Expected ALPN h2, actual %q", alpn)
+	}
+	if host, found := FindAuthority(tlvs); !found || host != "example.com" {
+		t.Fatalf("Expected authority example.com, actual %q", host)
+	}
+}
+
+func TestTLVsFromConnectionStateWithoutClientCertificate(t *testing.T) {
+	serverCert, serverLeaf := newTestCertificate(t, "example.com", newECDSAKey(t))
+	roots := x509.NewCertPool()
+	roots.AddCert(serverLeaf)
+
+	state := handshake(t,
+		&tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			MinVersion:   tls.VersionTLS13,
+		},
+		&tls.Config{
+			RootCAs:    roots,
+			ServerName: "example.com",
+		},
+	)
+
+	// Without the local certificate, the algorithms are omitted
+	tlvs, err := TLVsFromConnectionState(state, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if len(tlvs) != 2 || tlvs[1].Type != proxyproto.PP2_TYPE_AUTHORITY {
+		t.Fatalf("Expected SSL and authority TLVs, actual %#v", tlvs)
+	}
+
+	ssl, err := SSL(tlvs[0])
+	if err != nil {
+		t.Fatalf("Unexpected error parsing SSL TLV %v", err)
+	}
+	if !ssl.ClientSSL() || ssl.ClientCertConn() || ssl.ClientCertSess() || ssl.Verified() {
+		t.Fatalf("Unexpected client bits %#x and verify %d", ssl.Client, ssl.Verify)
+	}
+	if version, _ := ssl.SSLVersion(); version != "TLSv1.3" {
+		t.Fatalf("Expected TLSv1.3, actual %q", version)
+	}
+	if cipher, _ := ssl.Cipher(); cipher != tls.CipherSuiteName(state.CipherSuite) {
+		t.Fatalf("Expected %s, actual %q", tls.CipherSuiteName(state.CipherSuite), cipher)
+	}
+	for _, subType := range []proxyproto.PP2Type{proxyproto.PP2_SUBTYPE_SSL_CN, proxyproto.PP2_SUBTYPE_SSL_SIG_ALG, proxyproto.PP2_SUBTYPE_SSL_KEY_ALG} {
+		if value, ok := ssl.subTLV(subType); ok {
+			t.Fatalf("Expected no sub-TLV %#x, actual %q", subType, value)
+		}
+	}
+}
+
+func TestSSLFromConnectionStateWithoutHandshake(t *testing.T) {
+	tlv, err := SSLFromConnectionState(tls.ConnectionState{}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	ssl, err := SSL(tlv)
+	if err != nil {
+		t.Fatalf("Unexpected error parsing SSL TLV %v", err)
+	}
+	if ssl.ClientSSL() || ssl.Verified() || len(ssl.TLV) != 0 {
+		t.Fatalf("Unexpected SSL TLV %#v", ssl)
+	}
+}
@@ -0,0 +1,64 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"sync/atomic"
+)
+
+// ErrTrustedProxiesNotInitialized is returned by the Policy method of a
+// TrustedProxies which wasn't created with NewTrustedProxies.
+var ErrTrustedProxiesNotInitialized = errors.New("TrustedProxies must be created with NewTrustedProxies")
+
+// TrustedProxies is a set of IP addresses and IP ranges allowed to send a
+// proxy header, which can be updated while the listeners using it accept
+// connections, e.g. when the addresses of a load balancer fleet change.
+// It must be created with NewTrustedProxies.
+//
+// Its Policy method is a PolicyFunc:
+//
+//	trusted, err := proxyproto.NewTrustedProxies([]string{"10.0.0.0/8"}, proxyproto.REJECT)
+//	listener := &proxyproto.Listener{Listener: l, Policy: trusted.Policy}
+type TrustedProxies struct {
+	untrusted Policy
+	policy    atomic.Value // PolicyFunc
+}
+
+// NewTrustedProxies returns a TrustedProxies allowing the given IP addresses
+// and IP ranges. Connections from other upstream IPs get the untrusted
+// policy, IGNORE as for LaxWhiteListPolicy or REJECT as for
+// StrictWhiteListPolicy. If one of the provided IP addresses or IP ranges is
+// invalid it will return an error.
+func NewTrustedProxies(allowed []string, untrusted Policy) (*TrustedProxies, error) {
+	t := &TrustedProxies{untrusted: untrusted}
+	if err := t.Update(allowed); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Update replaces the allowed IP addresses and IP ranges. It is safe to
+// call while connections are accepted, which see either the previous or
+// the new set. If one of the provided IP addresses or IP ranges is invalid
+// the previous set is kept and an error is returned.
+func (t *TrustedProxies) Update(allowed []string) error {
+	allowFrom, err := parse(allowed)
+	if err != nil {
+		return err
+	}
+
+	t.policy.Store(whitelistPolicy(allowFrom, t.untrusted))
+	return nil
+}
+
+// Policy decides whether the upstream IP is allowed to send a proxy header
+// based on the current set. It can be used as a PolicyFunc. If t wasn't
+// created with NewTrustedProxies, connections are rejected with
+// ErrTrustedProxiesNotInitialized.
+func (t *TrustedProxies) Policy(upstream net.Addr) (Policy, error) {
+	policy, ok := t.policy.Load().(PolicyFunc)
+	if !ok {
+		return REJECT, ErrTrustedProxiesNotInitialized
+	}
+	return policy(upstream)
+}
@@ -0,0 +1,125 @@
+package proxyproto
+
+import (
+	"net"
+	"sync"
+	"testing"
+)
+
+func TestTrustedProxiesUpdate(t *testing.T) {
+	trusted, err := NewTrustedProxies([]string{"10.0.0.0/30"}, REJECT)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	upstream, err := net.ResolveTCPAddr("tcp", "10.0.1.1:45738")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if policy, err := trusted.Policy(upstream); err != nil || policy != REJECT {
+		t.Fatalf("Expected policy REJECT, got %v (%v)", policy, err)
+	}
+
+	if err := trusted.Update([]string{"10.0.1.0/24"}); err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if policy, err := trusted.Policy(upstream); err != nil || policy != USE {
+		t.Fatalf("Expected policy USE, got %v (%v)", policy, err)
+	}
+}
+
+func TestTrustedProxiesUpdateKeepsPreviousSetOnError(t *testing.T) {
+	trusted, err := NewTrustedProxies([]string{"10.0.0.1"}, IGNORE)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	if err := trusted.Update([]string{"10.0.0.2", "10.0.0.0/33"}); err == nil {
+		t.Fatal("Expected error, got none")
+	}
+
+	upstream, err := net.ResolveTCPAddr("tcp", "10.0.0.1:45738")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if policy, err := trusted.Policy(upstream); err != nil || policy != USE {
+		t.Fatalf("Expected policy USE, got %v (%v)", policy, err)
+	}
+}
+
+func TestNewTrustedProxiesWithInvalidIpAddressReturnsError(t *testing.T) {
+	if _, err := NewTrustedProxies([]string{"855.222.233.11"}, REJECT); err == nil {
+		t.Fatal("Expected error, got none")
+	}
+}
+
+func TestZeroValueTrustedProxiesRejects(t *testing.T) {
+	var trusted TrustedProxies
+
+	upstream, err := net.ResolveTCPAddr("tcp", "10.0.0.1:45738")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	if policy, err := trusted.Policy(upstream); err != ErrTrustedProxiesNotInitialized || policy != REJECT {
+		t.Fatalf("Expected policy REJECT with %v, got %v (%v)", ErrTrustedProxiesNotInitialized, policy, err)
+	}
+
+	// Accept fails instead of panicking
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	pl := &Listener{Listener: l, Policy: trusted.Policy}
+	defer pl.Close()
+
+	go func() {
+		conn, err := net.Dial("tcp", pl.Addr().String())
+		if err != nil {
+			t.Errorf("err: %v", err)
+			return
+		}
+		conn.Close()
+	}()
+
+	if _, err := pl.Accept(); err != ErrTrustedProxiesNotInitialized {
+		t.Fatalf("Expected %v, got %v", ErrTrustedProxiesNotInitialized, err)
+	}
+}
+
+func TestTrustedProxiesConcurrentUpdate(t *testing.T) {
+	trusted, err := NewTrustedProxies([]string{"10.0.0.1"}, IGNORE)
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+	var policy PolicyFunc = trusted.Policy
+
+	upstream, err := net.ResolveTCPAddr("tcp", "10.0.0.1:45738")
+	if err != nil {
+		t.Fatalf("err: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if p, err := policy(upstream); err != nil || (p != USE && p != IGNORE) {
+					t.Errorf("Unexpected policy %v (%v)", p, err)
+					return
+				}
+			}
+		}()
+	}
+	for j := 0; j < 1000; j++ {
+		allowed := []string{"10.0.0.1"}
+		if j%2 == 0 {
+			allowed = []string{"10.0.0.2"}
+		}
+		if err := trusted.Update(allowed); err != nil {
+			t.Fatalf("err: %v", err)
+		}
+	}
+	wg.Wait()
+}
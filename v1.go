@@ -11,6 +11,9 @@ import (
 const (
 	CRLF      = "\r\n"
 	SEPARATOR = " "
+
+	// Maximum length of a v1 line, CRLF included, see section 2.1.
+	maxVersion1Length = 107
 )
 
 func initVersion1() *Header {
@@ -22,14 +25,89 @@ func initVersion1() *Header {
 }
 
 func parseVersion1(reader *bufio.Reader) (*Header, error) {
+	if reader.Size() < maxVersion1Length {
+		// The buffer can't hold a whole header, consume the line instead
+		line, err := readVersion1Line(reader)
+		if err != nil {
+			return nil, err
+		}
+		return parseVersion1Line(string(line))
+	}
+
+	// Look for the end of the line without buffering more than the maximum
+	// length of a header, so that garbage can't make us buffer indefinitely.
+	var line []byte
+	for n := 0; line == nil; {
+		size := reader.Buffered()
+		if size <= n {
+			size = n + 1
+		}
+		if size > maxVersion1Length {
+			size = maxVersion1Length
+		}
+
+		b, err := reader.Peek(size)
+		if i := bytes.IndexByte(b[n:], '\n'); i >= 0 {
+			line = b[:n+i+1]
+		} else if n = len(b); err != nil {
+			return nil, newParseError(1, "line", n, ErrCantReadProtocolVersionAndCommand)
+		} else if n >= maxVersion1Length {
+			return nil, newParseError(1, "line", n, ErrVersion1HeaderTooLong)
+		}
+	}
+
+	header, err := parseVersion1Line(string(line))
+	if err != nil {
+		return nil, err
+	}
+	reader.Discard(len(line))
+	return header, nil
+}
+
+// readVersion1Line reads a v1 header line from a reader whose buffer is
+// smaller than the maximum length of a header, reading at most one buffer
+// past that length.
+func readVersion1Line(reader *bufio.Reader) ([]byte, error) {
+	var line []byte
+	for len(line) < maxVersion1Length {
+		b, err := reader.ReadSlice('\n')
+		line = append(line, b...)
+		if err == nil {
+			return line, nil
+		} else if err != bufio.ErrBufferFull {
+			return nil, newParseError(1, "line", len(line), ErrCantReadProtocolVersionAndCommand)
+		}
+	}
+	return nil, newParseError(1, "line", len(line), ErrVersion1HeaderTooLong)
+}
+
+// parseVersion1Line parses a whole v1 header line, CRLF included, as
+// specified in section 2.1.
+func parseVersion1Line(line string) (*Header, error) {
+	if len(line) > maxVersion1Length {
+		return nil, newParseError(1, "line", maxVersion1Length, ErrVersion1HeaderTooLong)
+	}
 	// Make sure we have a v1 header
-	line, err := reader.ReadString('\n')
 	if !strings.HasSuffix(line, CRLF) {
-		return nil, ErrCantReadProtocolVersionAndCommand
+		return nil, newParseError(1, "line", len(line)-1, ErrLineMustEndWithCrlf)
 	}
 	tokens := strings.Split(line[:len(line)-2], SEPARATOR)
-	if len(tokens) < 6 {
-		return nil, ErrCantReadProtocolVersionAndCommand
+	if len(tokens) < 2 || tokens[0] != string(SIGV1) {
+		return nil, newParseError(1, "protocol", len(SIGV1), ErrCantReadProtocolVersionAndCommand)
+	}
+
+	// Offsets of the tokens in the line, for error reporting
+	offsets := make([]int, len(tokens))
+	for i := 1; i < len(tokens); i++ {
+		offsets[i] = offsets[i-1] + len(tokens[i-1]) + len(SEPARATOR)
+	}
+	checkSeparators := func() error {
+		for i, token := range tokens {
+			if token == "" {
+				return newParseError(1, "separator", offsets[i]-len(SEPARATOR), ErrInvalidSeparator)
+			}
+		}
+		return nil
 	}
 
 	header := initVersion1()
@@ -40,26 +118,50 @@ func parseVersion1(reader *bufio.Reader) (*Header, error) {
 		header.TransportProtocol = TCPv4
 	case "TCP6":
 		header.TransportProtocol = TCPv6
-	default:
+	case "UNKNOWN":
+		// The receiver must ignore anything presented before the CRLF
 		header.TransportProtocol = UNSPEC
+		return header, nil
+	case "":
+		if len(tokens) == 2 {
+			return nil, newParseError(1, "protocol", offsets[1], ErrCantReadProtocolVersionAndCommand)
+		}
+		return nil, checkSeparators()
+	default:
+		return nil, newParseError(1, "protocol", offsets[1], ErrUnsupportedAddressFamilyAndProtocol)
+	}
+
+	if err := checkSeparators(); err != nil {
+		return nil, err
+	}
+	if len(tokens) != 6 {
+		return nil, newParseError(1, "fields", len(line)-len(CRLF), ErrInvalidTokenCount)
 	}
 
 	// Read addresses and ports
-	header.SourceAddress, err = parseV1IPAddress(header.TransportProtocol, tokens[2])
+	sourceIP, err := parseV1IPAddress(header.TransportProtocol, tokens[2])
 	if err != nil {
-		return nil, err
+		return nil, newParseError(1, "source address", offsets[2], err)
 	}
-	header.DestinationAddress, err = parseV1IPAddress(header.TransportProtocol, tokens[3])
+	destIP, err := parseV1IPAddress(header.TransportProtocol, tokens[3])
 	if err != nil {
-		return nil, err
+		return nil, newParseError(1, "destination address", offsets[3], err)
 	}
-	header.SourcePort, err = parseV1PortNumber(tokens[4])
+	sourcePort, err := parseV1PortNumber(tokens[4])
 	if err != nil {
-		return nil, err
+		return nil, newParseError(1, "source port", offsets[4], err)
 	}
-	header.DestinationPort, err = parseV1PortNumber(tokens[5])
+	destPort, err := parseV1PortNumber(tokens[5])
 	if err != nil {
-		return nil, err
+		return nil, newParseError(1, "destination port", offsets[5], err)
+	}
+	header.SourceAddr = &net.TCPAddr{
+		IP:   sourceIP,
+		Port: int(sourcePort),
+	}
+	header.DestinationAddr = &net.TCPAddr{
+		IP:   destIP,
+		Port: int(destPort),
 	}
 	return header, nil
 }
@@ -67,50 +169,74 @@ func parseVersion1(reader *bufio.Reader) (*Header, error) {
 func (header *Header) formatVersion1() ([]byte, error) {
 	// As of version 1, only "TCP4" ( \x54 \x43 \x50 \x34 ) for TCP over IPv4,
 	// and "TCP6" ( \x54 \x43 \x50 \x36 ) for TCP over IPv6 are allowed.
-	proto := "UNKNOWN"
-	if header.TransportProtocol == TCPv4 {
+	// Anything else is sent as "UNKNOWN", without addresses.
+	var proto string
+	var sourceIP, destIP net.IP
+	switch header.TransportProtocol {
+	case TCPv4:
 		proto = "TCP4"
-	} else if header.TransportProtocol == TCPv6 {
+		if sourceIP, destIP, _ = header.IPs(); sourceIP.To4() == nil || destIP.To4() == nil {
+			return nil, ErrInvalidAddress
+		}
+	case TCPv6:
 		proto = "TCP6"
+		if sourceIP, destIP, _ = header.IPs(); len(sourceIP) != net.IPv6len || len(destIP) != net.IPv6len || sourceIP.To4() != nil || destIP.To4() != nil {
+			return nil, ErrInvalidAddress
+		}
+	default:
+		return []byte(string(SIGV1) + SEPARATOR + "UNKNOWN" + CRLF), nil
 	}
+	sourcePort, destPort, _ := header.Ports()
 
 	var buf bytes.Buffer
 	buf.Write(SIGV1)
 	buf.WriteString(SEPARATOR)
 	buf.WriteString(proto)
 	buf.WriteString(SEPARATOR)
-	buf.WriteString(header.SourceAddress.String())
+	buf.WriteString(sourceIP.String())
 	buf.WriteString(SEPARATOR)
-	buf.WriteString(header.DestinationAddress.String())
+	buf.WriteString(destIP.String())
 	buf.WriteString(SEPARATOR)
-	buf.WriteString(strconv.Itoa(int(header.SourcePort)))
+	buf.WriteString(strconv.Itoa(sourcePort))
 	buf.WriteString(SEPARATOR)
-	buf.WriteString(strconv.Itoa(int(header.DestinationPort)))
+	buf.WriteString(strconv.Itoa(destPort))
 	buf.WriteString(CRLF)
 
 	return buf.Bytes(), nil
 }
 
-func parseV1PortNumber(portStr string) (port uint16, err error) {
-	_port, _err := strconv.Atoi(portStr)
-	if _err == nil {
-		if _port < 0 || _port > 65535 {
-			err = ErrInvalidPortNumber
-		} else {
-			port = uint16(_port)
+// parseV1PortNumber parses a TCP port, a decimal number between 0 and 65535
+// without leading zeros.
+func parseV1PortNumber(portStr string) (uint16, error) {
+	if len(portStr) == 0 || len(portStr) > 5 || (len(portStr) > 1 && portStr[0] == '0') {
+		return 0, ErrInvalidPortNumber
+	}
+	for _, c := range portStr {
+		if c < '0' || c > '9' {
+			return 0, ErrInvalidPortNumber
 		}
-	} else {
-		err = ErrInvalidPortNumber
 	}
 
-	return
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port > 65535 {
+		return 0, ErrInvalidPortNumber
+	}
+	return uint16(port), nil
 }
 
-func parseV1IPAddress(protocol AddressFamilyAndProtocol, addrStr string) (addr net.IP, err error) {
-	addr = net.ParseIP(addrStr)
+// parseV1IPAddress parses an IPv4 address in dotted-quad notation for TCP4,
+// or an IPv6 address for TCP6. Leading zeros are rejected by net.ParseIP.
+func parseV1IPAddress(protocol AddressFamilyAndProtocol, addrStr string) (net.IP, error) {
+	addr := net.ParseIP(addrStr)
+	if addr == nil {
+		return nil, ErrInvalidAddress
+	}
 	tryV4 := addr.To4()
-	if (protocol == TCPv4 && tryV4 == nil) || (protocol == TCPv6 && tryV4 != nil) {
-		err = ErrInvalidAddress
+	if protocol == TCPv4 && (tryV4 == nil || strings.Contains(addrStr, ":")) {
+		return nil, ErrInvalidAddress
+	}
+	if protocol == TCPv6 && (tryV4 != nil || !strings.Contains(addrStr, ":")) {
+		return nil, ErrInvalidAddress
 	}
-	return
+	return addr, nil
 }
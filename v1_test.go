@@ -3,6 +3,8 @@ package proxyproto
 import (
 	"bufio"
 	"bytes"
+	"errors"
+	"net"
 	"strconv"
 	"strings"
 	"testing"
@@ -49,11 +51,63 @@ var invalidParseV1Tests = []struct {
 	{newBufioReader([]byte("PROXY TCP4 " + TCP4AddressesAndInvalidPorts + CRLF)),
 		ErrInvalidPortNumber,
 	},
+	{
+		newBufioReader([]byte("PROXY TCP4 " + strings.Repeat("1", 200) + CRLF)),
+		ErrVersion1HeaderTooLong,
+	},
+	{
+		newBufioReader([]byte("PROXY TCP4 " + TCP4AddressesAndPorts + "\n")),
+		ErrLineMustEndWithCrlf,
+	},
+	{
+		newBufioReader([]byte("PROXY TCP4  " + TCP4AddressesAndPorts + CRLF)),
+		ErrInvalidSeparator,
+	},
+	{
+		newBufioReader([]byte("PROXY TCP4 " + TCP4AddressesAndPorts + " " + CRLF)),
+		ErrInvalidSeparator,
+	},
+	{
+		newBufioReader([]byte("PROXY TCP4 " + TCP4AddressesAndPorts + " 80" + CRLF)),
+		ErrInvalidTokenCount,
+	},
+	{
+		newBufioReader([]byte("PROXY TCP4 " + IP4_ADDR + " " + IP4_ADDR + CRLF)),
+		ErrInvalidTokenCount,
+	},
+	{
+		newBufioReader([]byte("PROXY UDP4 " + TCP4AddressesAndPorts + CRLF)),
+		ErrUnsupportedAddressFamilyAndProtocol,
+	},
+	{
+		newBufioReader([]byte("PROXY TCP4 127.0.0.01 127.0.0.1 1000 2000" + CRLF)),
+		ErrInvalidAddress,
+	},
+	{
+		newBufioReader([]byte("PROXY TCP6 ::ffff:127.0.0.1 ::1 1000 2000" + CRLF)),
+		ErrInvalidAddress,
+	},
+	{
+		newBufioReader([]byte("PROXY TCP4 127.0.0.1 127.0.0.1 01000 2000" + CRLF)),
+		ErrInvalidPortNumber,
+	},
+	{
+		newBufioReader([]byte("PROXY TCP4 127.0.0.1 127.0.0.1 00 2000" + CRLF)),
+		ErrInvalidPortNumber,
+	},
+	{
+		newBufioReader([]byte("PROXY TCP4 127.0.0.1 127.0.0.1 65536 2000" + CRLF)),
+		ErrInvalidPortNumber,
+	},
+	{
+		newBufioReader([]byte("PROXY TCP4 127.0.0.1 127.0.0.1 +1000 2000" + CRLF)),
+		ErrInvalidPortNumber,
+	},
 }
 
 func TestReadV1Invalid(t *testing.T) {
 	for _, tt := range invalidParseV1Tests {
-		if _, err := Read(tt.reader); err != tt.expectedError {
+		if _, err := Read(tt.reader); !errors.Is(err, tt.expectedError) {
 			t.Fatalf("TestReadV1Invalid: expected %s, actual %s", tt.expectedError, err.Error())
 		}
 	}
@@ -63,28 +117,53 @@ var validParseAndWriteV1Tests = []struct {
 	reader         *bufio.Reader
 	expectedHeader *Header
 }{
+	{
+		// Section 2.1 allows ports in the range [0..65535]
+		newBufioReader([]byte("PROXY TCP4 127.0.0.1 127.0.0.1 0 2000" + CRLF)),
+		&Header{
+			Version:           1,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: 0,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: 2000,
+			},
+		},
+	},
 	{
 		bufio.NewReader(strings.NewReader(fixtureTCP4V1)),
 		&Header{
-			Version:            1,
-			Command:            PROXY,
-			TransportProtocol:  TCPv4,
-			SourceAddress:      v4addr,
-			DestinationAddress: v4addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
+			Version:           1,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
 		},
 	},
 	{
 		bufio.NewReader(strings.NewReader(fixtureTCP6V1)),
 		&Header{
-			Version:            1,
-			Command:            PROXY,
-			TransportProtocol:  TCPv6,
-			SourceAddress:      v6addr,
-			DestinationAddress: v6addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
+			Version:           1,
+			Command:           PROXY,
+			TransportProtocol: TCPv6,
+			SourceAddr: &net.TCPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
 		},
 	},
 }
@@ -101,6 +180,99 @@ func TestParseV1Valid(t *testing.T) {
 	}
 }
 
+func TestParseV1Unknown(t *testing.T) {
+	for _, line := range []string{"PROXY UNKNOWN\r\n", "PROXY UNKNOWN ffff::1 ffff::2 1000 2000\r\n", "PROXY UNKNOWN garbage  \r\n"} {
+		reader := newBufioReader([]byte(line + "GET /"))
+		header, err := Read(reader)
+		if err != nil {
+			t.Fatalf("TestParseV1Unknown: unexpected error %v for %q", err, line)
+		}
+		if header.TransportProtocol != UNSPEC || header.SourceAddr != nil || header.DestinationAddr != nil {
+			t.Fatalf("TestParseV1Unknown: expected no addresses, actual %#v", header)
+		}
+
+		tail, _ := reader.ReadString('/')
+		if tail != "GET /" {
+			t.Fatalf("TestParseV1Unknown: expected the line to be consumed, actual %q", tail)
+		}
+	}
+}
+
+func TestReadV1DoesNotBufferPastMaximumLength(t *testing.T) {
+	data := bytes.NewReader([]byte("PROXY " + strings.Repeat("A", 1<<20)))
+	reader := bufio.NewReader(data)
+	if _, err := Read(reader); !errors.Is(err, ErrVersion1HeaderTooLong) {
+		t.Fatalf("TestReadV1DoesNotBufferPastMaximumLength: expected %v, actual %v", ErrVersion1HeaderTooLong, err)
+	}
+	if read := int64(1<<20+6) - int64(data.Len()); read > int64(reader.Size()) {
+		t.Fatalf("TestReadV1DoesNotBufferPastMaximumLength: read %d bytes", read)
+	}
+}
+
+func TestReadV1WithSmallBuffer(t *testing.T) {
+	// 16 bytes is the minimum size of a bufio.Reader
+	reader := bufio.NewReaderSize(strings.NewReader(fixtureTCP6V1), 16)
+	header, err := Read(reader)
+	if err != nil {
+		t.Fatalf("TestReadV1WithSmallBuffer: unexpected error %v", err)
+	}
+	if header.TransportProtocol != TCPv6 || header.SourceAddr.String() != net.JoinHostPort(IP6_ADDR, strconv.Itoa(PORT)) {
+		t.Fatalf("TestReadV1WithSmallBuffer: unexpected header %#v", header)
+	}
+	if tail, _ := reader.ReadString(0); tail != "GET /" {
+		t.Fatalf("TestReadV1WithSmallBuffer: expected the line to be consumed, actual %q", tail)
+	}
+
+	tests := []struct {
+		raw           string
+		expectedError error
+	}{
+		{"PROXY " + strings.Repeat("A", 1<<20), ErrVersion1HeaderTooLong},
+		{"PROXY " + strings.Repeat("A", maxVersion1Length) + CRLF, ErrVersion1HeaderTooLong},
+		{"PROXY TCP4 " + TCP4AddressesAndPorts, ErrCantReadProtocolVersionAndCommand},
+		{"PROXY TCP4 " + TCP4AddressesAndPorts + "\n", ErrLineMustEndWithCrlf},
+	}
+	for _, tt := range tests {
+		data := strings.NewReader(tt.raw)
+		reader := bufio.NewReaderSize(data, 16)
+		if _, err := Read(reader); !errors.Is(err, tt.expectedError) {
+			t.Fatalf("TestReadV1WithSmallBuffer: expected %v, actual %v", tt.expectedError, err)
+		}
+		if read := len(tt.raw) - data.Len(); read > maxVersion1Length+reader.Size() {
+			t.Fatalf("TestReadV1WithSmallBuffer: read %d bytes", read)
+		}
+	}
+}
+
+func TestFormatV1Unknown(t *testing.T) {
+	for _, header := range []*Header{
+		{Version: 1, Command: LOCAL, TransportProtocol: UNSPEC},
+		HeaderProxyFromAddrs(1, &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 1000}, &net.TCPAddr{IP: net.ParseIP("::1"), Port: 2000}),
+		{Version: 1, Command: PROXY, TransportProtocol: UDPv4},
+	} {
+		raw, err := header.Format()
+		if err != nil {
+			t.Fatalf("TestFormatV1Unknown: unexpected error %v", err)
+		}
+		if string(raw) != "PROXY UNKNOWN\r\n" {
+			t.Fatalf("TestFormatV1Unknown: expected %q, actual %q", "PROXY UNKNOWN\r\n", raw)
+		}
+	}
+}
+
+func TestFormatV1InvalidAddress(t *testing.T) {
+	header := &Header{
+		Version:           1,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        &net.TCPAddr{IP: net.ParseIP("::1"), Port: 1000},
+		DestinationAddr:   &net.TCPAddr{IP: net.ParseIP("10.1.1.1"), Port: 2000},
+	}
+	if _, err := header.Format(); err != ErrInvalidAddress {
+		t.Fatalf("TestFormatV1InvalidAddress: expected %v, actual %v", ErrInvalidAddress, err)
+	}
+}
+
 func TestWriteV1Valid(t *testing.T) {
 	for _, tt := range validParseAndWriteV1Tests {
 		var b bytes.Buffer
@@ -5,13 +5,13 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
-	"io"
+	"net"
 )
 
 var (
 	lengthV4   = uint16(12)
 	lengthV6   = uint16(36)
-	lengthUnix = uint16(218)
+	lengthUnix = uint16(216)
 
 	lengthV4Bytes = func() []byte {
 		a := make([]byte, 2)
@@ -23,7 +23,8 @@ var (
 		binary.BigEndian.PutUint16(a, lengthV6)
 		return a
 	}()
-	lengthUnixBytes = func() []byte {
+	lengthUnspecBytes = []byte{0, 0}
+	lengthUnixBytes   = func() []byte {
 		a := make([]byte, 2)
 		binary.BigEndian.PutUint16(a, lengthUnix)
 		return a
@@ -31,118 +32,144 @@ var (
 	errUint16Overflow = errors.New("uint16 overflow")
 )
 
-type _ports struct {
-	SrcPort uint16
-	DstPort uint16
-}
+const (
+	// Length of the signature, command, transport protocol and length fields.
+	lengthV2Preamble = 16
+	// Length of the Unix path fields of the v2 address block, see section 2.2.
+	lengthUnixPath = 108
+)
 
-type _addr4 struct {
-	Src     [4]byte
-	Dst     [4]byte
-	SrcPort uint16
-	DstPort uint16
-}
+func parseVersion2(reader *bufio.Reader, opts ReadOptions) (*Header, error) {
+	command, transportProtocol, payload, err := readVersion2Preamble(reader, opts.MaxHeaderSize)
+	if err != nil {
+		return nil, err
+	}
+	addrLen := int(addressesLength(transportProtocol))
+	if opts.MaxTLVs > 0 && countTLVs(payload[addrLen:]) > opts.MaxTLVs {
+		return nil, newParseError(2, "TLVs", lengthV2Preamble+addrLen, ErrTooManyTLVs)
+	}
 
-type _addr6 struct {
-	Src [16]byte
-	Dst [16]byte
-	_ports
-}
+	header := parseVersion2Payload(command, transportProtocol, payload)
+
+	if _, err := reader.Discard(len(payload)); err != nil {
+		return nil, newParseError(2, "payload", lengthV2Preamble, ErrInvalidLength)
+	}
 
-type _addrUnix struct {
-	Src [108]byte
-	Dst [108]byte
+	return header, nil
 }
 
-func parseVersion2(reader *bufio.Reader) (header *Header, err error) {
-	// Skip first 12 bytes (signature)
-	for i := 0; i < 12; i++ {
-		if _, err = reader.ReadByte(); err != nil {
-			return nil, ErrCantReadProtocolVersionAndCommand
+// parseVersion2Payload builds a header from the addresses and TLVs which
+// follow the fixed part of a v2 header. payload is copied.
+func parseVersion2Payload(command ProtocolVersionAndCommand, transportProtocol AddressFamilyAndProtocol, payload []byte) *Header {
+	header := &Header{
+		Version:           2,
+		Command:           command,
+		TransportProtocol: transportProtocol,
+	}
+
+	// Read addresses and ports
+	if header.TransportProtocol.IsIPv4() || header.TransportProtocol.IsIPv6() {
+		ipLen := net.IPv4len
+		if header.TransportProtocol.IsIPv6() {
+			ipLen = net.IPv6len
+		}
+		sourceIP, destIP, sourcePort, destPort := parseVersion2IPAddresses(payload, ipLen)
+		// Copy the IPs as the payload buffer may be reused
+		header.SourceAddr = newIPAddr(header.TransportProtocol, append(net.IP(nil), sourceIP...), sourcePort)
+		header.DestinationAddr = newIPAddr(header.TransportProtocol, append(net.IP(nil), destIP...), destPort)
+	} else if header.TransportProtocol.IsUnix() {
+		network := "unix"
+		if header.TransportProtocol.IsDatagram() {
+			network = "unixgram"
+		}
+
+		header.SourceAddr = &net.UnixAddr{
+			Net:  network,
+			Name: parseUnixName(payload[:lengthUnixPath]),
+		}
+		header.DestinationAddr = &net.UnixAddr{
+			Net:  network,
+			Name: parseUnixName(payload[lengthUnixPath:lengthUnix]),
 		}
 	}
 
-	header = new(Header)
-	header.Version = 2
+	// Copy the address block, kept to check the CRC32C, along with the
+	// optional Type-Length-Value vector
+	addrLen := int(addressesLength(transportProtocol))
+	raw := append(make([]byte, 0, len(payload)), payload...)
+	header.rawAddresses = raw[:addrLen:addrLen]
+	header.rawTLVs = raw[addrLen:]
 
-	// Read the 13th byte, protocol version and command
-	b13, err := reader.ReadByte()
+	return header
+}
+
+// readVersion2Preamble reads the signature, the command, the transport
+// protocol and the length of a v2 header, and peeks at the payload which
+// follows. The payload is only valid until the next read from reader and
+// hasn't been discarded from it yet. If maxHeaderSize is positive, longer
+// headers are rejected before their payload is buffered.
+func readVersion2Preamble(reader *bufio.Reader, maxHeaderSize int) (ProtocolVersionAndCommand, AddressFamilyAndProtocol, []byte, error) {
+	preamble, _ := reader.Peek(lengthV2Preamble)
+	command, transportProtocol, length, err := parseVersion2Preamble(preamble)
 	if err != nil {
-		return nil, ErrCantReadProtocolVersionAndCommand
+		return 0, 0, nil, err
 	}
-	header.Command = ProtocolVersionAndCommand(b13)
-	if _, ok := supportedCommand[header.Command]; !ok {
-		return nil, ErrUnsupportedProtocolVersionAndCommand
+	if maxHeaderSize > 0 && lengthV2Preamble+int(length) > maxHeaderSize {
+		return 0, 0, nil, newParseError(2, "length", 14, ErrHeaderTooLarge)
 	}
+	reader.Discard(lengthV2Preamble)
 
-	// Read the 14th byte, address family and protocol
-	b14, err := reader.ReadByte()
+	// Make sure there are bytes available as specified in length
+	payload, err := reader.Peek(int(length))
 	if err != nil {
-		return nil, ErrCantReadAddressFamilyAndProtocol
-	}
-	header.TransportProtocol = AddressFamilyAndProtocol(b14)
-	if _, ok := supportedTransportProtocol[header.TransportProtocol]; !ok {
-		return nil, ErrUnsupportedAddressFamilyAndProtocol
+		return 0, 0, nil, newParseError(2, "payload", lengthV2Preamble, ErrInvalidLength)
 	}
 
-	// Make sure there are bytes available as specified in length
-	var length uint16
-	if err := binary.Read(io.LimitReader(reader, 2), binary.BigEndian, &length); err != nil {
-		return nil, ErrCantReadLength
+	return command, transportProtocol, payload, nil
+}
+
+// parseVersion2Preamble validates the 16 bytes which start a v2 header: the
+// signature, the command, the transport protocol and the payload length.
+// If b is too short, the error names the first field which is missing.
+func parseVersion2Preamble(b []byte) (ProtocolVersionAndCommand, AddressFamilyAndProtocol, uint16, error) {
+	// The 13th byte is the protocol version and command
+	if len(b) < 13 {
+		return 0, 0, 0, newParseError(2, "command", 12, ErrCantReadProtocolVersionAndCommand)
 	}
-	if !header.validateLength(length) {
-		return nil, ErrInvalidLength
+	command := ProtocolVersionAndCommand(b[12])
+	if _, ok := supportedCommand[command]; !ok {
+		return 0, 0, 0, newParseError(2, "command", 12, ErrUnsupportedProtocolVersionAndCommand)
 	}
 
-	if _, err := reader.Peek(int(length)); err != nil {
-		return nil, ErrInvalidLength
+	// The 14th byte is the address family and protocol
+	if len(b) < 14 {
+		return 0, 0, 0, newParseError(2, "transport protocol", 13, ErrCantReadAddressFamilyAndProtocol)
+	}
+	transportProtocol := AddressFamilyAndProtocol(b[13])
+	if _, ok := supportedTransportProtocol[transportProtocol]; !ok {
+		return 0, 0, 0, newParseError(2, "transport protocol", 13, ErrUnsupportedAddressFamilyAndProtocol)
 	}
 
-	// Length-limited reader for payload section
-	payloadReader := io.LimitReader(reader, int64(length)).(*io.LimitedReader)
-
-	// Read addresses and ports
-	if header.TransportProtocol.IsIPv4() {
-		var addr _addr4
-		if err := binary.Read(payloadReader, binary.BigEndian, &addr); err != nil {
-			return nil, ErrInvalidAddress
-		}
-		header.SourceAddress = addr.Src[:]
-		header.DestinationAddress = addr.Dst[:]
-		header.SourcePort = addr.SrcPort
-		header.DestinationPort = addr.DstPort
-	} else if header.TransportProtocol.IsIPv6() {
-		var addr _addr6
-		if err := binary.Read(payloadReader, binary.BigEndian, &addr); err != nil {
-			return nil, ErrInvalidAddress
-		}
-		header.SourceAddress = addr.Src[:]
-		header.DestinationAddress = addr.Dst[:]
-		header.SourcePort = addr.SrcPort
-		header.DestinationPort = addr.DstPort
-	}
-	// TODO fully support Unix addresses
-	//	else if header.TransportProtocol.IsUnix() {
-	//		var addr _addrUnix
-	//		if err := binary.Read(payloadReader, binary.BigEndian, &addr); err != nil {
-	//			return nil, ErrInvalidAddress
-	//		}
-	//
-	//if header.SourceAddress, err = net.ResolveUnixAddr("unix", string(addr.Src[:])); err != nil {
-	//	return nil, ErrCantResolveSourceUnixAddress
-	//}
-	//if header.DestinationAddress, err = net.ResolveUnixAddr("unix", string(addr.Dst[:])); err != nil {
-	//	return nil, ErrCantResolveDestinationUnixAddress
-	//}
-	//}
-
-	// Copy bytes for optional Type-Length-Value vector
-	header.rawTLVs = make([]byte, payloadReader.N) // Allocate minimum size slice
-	if _, err = io.ReadFull(payloadReader, header.rawTLVs); err != nil && err != io.EOF {
-		return nil, err
+	// The 15th and 16th bytes are the length of the payload
+	if len(b) < lengthV2Preamble {
+		return 0, 0, 0, newParseError(2, "length", 14, ErrCantReadLength)
+	}
+	length := binary.BigEndian.Uint16(b[14:lengthV2Preamble])
+	if !validateLength(transportProtocol, length) {
+		return 0, 0, 0, newParseError(2, "length", 14, ErrInvalidLength)
 	}
 
-	return header, nil
+	return command, transportProtocol, length, nil
+}
+
+// parseVersion2IPAddresses decodes the IPv4 or IPv6 address block at the
+// beginning of payload. The returned IPs point into payload.
+func parseVersion2IPAddresses(payload []byte, ipLen int) (sourceIP, destIP []byte, sourcePort, destPort uint16) {
+	sourceIP = payload[:ipLen]
+	destIP = payload[ipLen : 2*ipLen]
+	sourcePort = binary.BigEndian.Uint16(payload[2*ipLen:])
+	destPort = binary.BigEndian.Uint16(payload[2*ipLen+2:])
+	return sourceIP, destIP, sourcePort, destPort
 }
 
 func (header *Header) formatVersion2() ([]byte, error) {
@@ -150,61 +177,118 @@ func (header *Header) formatVersion2() ([]byte, error) {
 	buf.Write(SIGV2)
 	buf.WriteByte(header.Command.toByte())
 	buf.WriteByte(header.TransportProtocol.toByte())
-	var addrSrc, addrDst []byte
+
+	var length []byte
+	var addresses []byte
+	var err error
 	if header.TransportProtocol.IsIPv4() {
-        hdrLen, err := addTLVLen(lengthV4Bytes, len(header.rawTLVs))
-        if err != nil {
-            return nil, err
-        }
-        buf.Write(hdrLen)
-		addrSrc = header.SourceAddress.To4()
-		addrDst = header.DestinationAddress.To4()
+		length = lengthV4Bytes
+		addresses, err = header.formatVersion2IPAddresses(net.IPv4len)
 	} else if header.TransportProtocol.IsIPv6() {
-        hdrLen, err := addTLVLen(lengthV6Bytes, len(header.rawTLVs))
-        if err != nil {
-            return nil, err
-        }
-        buf.Write(hdrLen)
-		addrSrc = header.SourceAddress.To16()
-		addrDst = header.DestinationAddress.To16()
+		length = lengthV6Bytes
+		addresses, err = header.formatVersion2IPAddresses(net.IPv6len)
 	} else if header.TransportProtocol.IsUnix() {
-		buf.Write(lengthUnixBytes)
-		// TODO is below right?
-		addrSrc = []byte(header.SourceAddress.String())
-		addrDst = []byte(header.DestinationAddress.String())
+		length = lengthUnixBytes
+		addresses, err = header.formatVersion2UnixAddresses()
+	} else {
+		length = lengthUnspecBytes
+	}
+	if err != nil {
+		return nil, err
 	}
-	buf.Write(addrSrc)
-	buf.Write(addrDst)
 
-	portSrcBytes := func() []byte {
-		a := make([]byte, 2)
-		binary.BigEndian.PutUint16(a, header.SourcePort)
-		return a
-	}()
-	buf.Write(portSrcBytes)
+	hdrLen, err := addTLVLen(length, len(header.rawTLVs))
+	if err != nil {
+		return nil, err
+	}
+	buf.Write(hdrLen)
+	buf.Write(addresses)
+	if len(header.rawTLVs) > 0 {
+		buf.Write(header.rawTLVs)
+	}
 
-	portDstBytes := func() []byte {
-		a := make([]byte, 2)
-		binary.BigEndian.PutUint16(a, header.DestinationPort)
-		return a
-	}()
-	buf.Write(portDstBytes)
-    if len(header.rawTLVs) > 0 {
-        buf.Write(header.rawTLVs)
-    }
+	raw := buf.Bytes()
+	fillCRC32C(raw, header.rawTLVs)
+	return raw, nil
+}
+
+func (header *Header) formatVersion2IPAddresses(ipLen int) ([]byte, error) {
+	sourceIP, destIP, ok := header.IPs()
+	if !ok {
+		return nil, ErrInvalidAddress
+	}
+	sourcePort, destPort, _ := header.Ports()
+
+	if ipLen == net.IPv4len {
+		sourceIP, destIP = sourceIP.To4(), destIP.To4()
+	} else {
+		sourceIP, destIP = sourceIP.To16(), destIP.To16()
+	}
+	if sourceIP == nil || destIP == nil {
+		return nil, ErrInvalidAddress
+	}
 
-	return buf.Bytes(), nil
+	addresses := make([]byte, 2*ipLen+4)
+	copy(addresses, sourceIP)
+	copy(addresses[ipLen:], destIP)
+	binary.BigEndian.PutUint16(addresses[2*ipLen:], uint16(sourcePort))
+	binary.BigEndian.PutUint16(addresses[2*ipLen+2:], uint16(destPort))
+	return addresses, nil
 }
 
-func (header *Header) validateLength(length uint16) bool {
-	if header.TransportProtocol.IsIPv4() {
-		return length >= lengthV4
-	} else if header.TransportProtocol.IsIPv6() {
-		return length >= lengthV6
-	} else if header.TransportProtocol.IsUnix() {
-		return length >= lengthUnix
+func (header *Header) formatVersion2UnixAddresses() ([]byte, error) {
+	sourceAddr, destAddr, ok := header.UnixAddrs()
+	if !ok {
+		return nil, ErrInvalidAddress
+	}
+
+	if len(sourceAddr.Name) > lengthUnixPath || len(destAddr.Name) > lengthUnixPath {
+		return nil, ErrInvalidAddress
+	}
+
+	// Unused bytes are NUL-padded
+	addresses := make([]byte, lengthUnix)
+	copy(addresses, sourceAddr.Name)
+	copy(addresses[lengthUnixPath:], destAddr.Name)
+	return addresses, nil
+}
+
+func validateLength(transportProtocol AddressFamilyAndProtocol, length uint16) bool {
+	return length >= addressesLength(transportProtocol)
+}
+
+// addressesLength returns the length of the address block of a v2 header.
+func addressesLength(transportProtocol AddressFamilyAndProtocol) uint16 {
+	if transportProtocol.IsIPv4() {
+		return lengthV4
+	} else if transportProtocol.IsIPv6() {
+		return lengthV6
+	} else if transportProtocol.IsUnix() {
+		return lengthUnix
+	}
+	// Addresses are skipped for UNSPEC, only TLVs may follow
+	return 0
+}
+
+func newIPAddr(transport AddressFamilyAndProtocol, ip net.IP, port uint16) net.Addr {
+	if transport.IsDatagram() {
+		return &net.UDPAddr{
+			IP:   ip,
+			Port: int(port),
+		}
+	}
+	return &net.TCPAddr{
+		IP:   ip,
+		Port: int(port),
+	}
+}
+
+// parseUnixName returns the path stored in a NUL-padded Unix address block.
+func parseUnixName(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
 	}
-	return false
+	return string(b)
 }
 
 // addTLVLen adds the length of the TLV to the header length or errors on uint16 overflow.
@@ -4,7 +4,9 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"math/rand"
+	"net"
 	"reflect"
 	"testing"
 )
@@ -45,6 +47,8 @@ var (
 	fixtureIPv6Address  = append(addressesIPv6, ports...)
 	fixtureIPv6V2       = append(lengthV6Bytes, fixtureIPv6Address...)
 	fixtureIPv6V2Padded = append(append(lengthPaddedBytes, fixtureIPv6Address...), make([]byte, lengthPadded-lengthV6)...)
+	fixtureUnixAddress  = append(unixAddressBytes("/run/src.sock"), unixAddressBytes("/run/dst.sock")...)
+	fixtureUnixV2       = append(lengthUnixBytes, fixtureUnixAddress...)
 	fixtureTLV          = func() []byte {
 		tlv := make([]byte, 2+rand.Intn(1<<12)) // Not enough to overflow, at least size two
 		rand.Read(tlv)
@@ -113,7 +117,7 @@ var invalidParseV2Tests = []struct {
 
 func TestParseV2Invalid(t *testing.T) {
 	for _, tt := range invalidParseV2Tests {
-		if _, err := Read(tt.reader); err != tt.expectedError {
+		if _, err := Read(tt.reader); !errors.Is(err, tt.expectedError) {
 			t.Fatalf("TestParseV2Invalid: expected %s, actual %s", tt.expectedError, err.Error())
 		}
 	}
@@ -127,96 +131,166 @@ var validParseAndWriteV2Tests = []struct {
 	{
 		newBufioReader(append(append(SIGV2, LOCAL, TCPv4), fixtureIPv4V2...)),
 		&Header{
-			Version:            2,
-			Command:            LOCAL,
-			TransportProtocol:  TCPv4,
-			SourceAddress:      v4addr,
-			DestinationAddress: v4addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
+			Version:           2,
+			Command:           LOCAL,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
 		},
 	},
 	// PROXY TCP IPv4
 	{
 		newBufioReader(append(append(SIGV2, PROXY, TCPv4), fixtureIPv4V2...)),
 		&Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  TCPv4,
-			SourceAddress:      v4addr,
-			DestinationAddress: v4addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
 		},
 	},
 	// PROXY TCP IPv6
 	{
 		newBufioReader(append(append(SIGV2, PROXY, TCPv6), fixtureIPv6V2...)),
 		&Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  TCPv6,
-			SourceAddress:      v6addr,
-			DestinationAddress: v6addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv6,
+			SourceAddr: &net.TCPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
 		},
 	},
 	// PROXY TCP IPv4 with TLV
 	{
 		newBufioReader(append(append(SIGV2, PROXY, TCPv4), fixtureIPv4V2TLV...)),
 		&Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  TCPv4,
-			SourceAddress:      v4addr,
-			DestinationAddress: v4addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
-			rawTLVs:            fixtureTLV,
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
+			rawTLVs: fixtureTLV,
 		},
 	},
 	// PROXY TCP IPv6 with TLV
 	{
 		newBufioReader(append(append(SIGV2, PROXY, TCPv6), fixtureIPv6V2TLV...)),
 		&Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  TCPv6,
-			SourceAddress:      v6addr,
-			DestinationAddress: v6addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
-			rawTLVs:            fixtureTLV,
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv6,
+			SourceAddr: &net.TCPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
+			rawTLVs: fixtureTLV,
 		},
 	},
 	// PROXY UDP IPv4
 	{
 		newBufioReader(append(append(SIGV2, PROXY, UDPv4), fixtureIPv4V2...)),
 		&Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  UDPv4,
-			SourceAddress:      v4addr,
-			DestinationAddress: v4addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: UDPv4,
+			SourceAddr: &net.UDPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.UDPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
 		},
 	},
 	// PROXY UDP IPv6
 	{
 		newBufioReader(append(append(SIGV2, PROXY, UDPv6), fixtureIPv6V2...)),
 		&Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  UDPv6,
-			SourceAddress:      v6addr,
-			DestinationAddress: v6addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: UDPv6,
+			SourceAddr: &net.UDPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.UDPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
+		},
+	},
+	// PROXY Unix stream
+	{
+		newBufioReader(append(append(SIGV2, PROXY, UnixStream), fixtureUnixV2...)),
+		&Header{
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: UnixStream,
+			SourceAddr: &net.UnixAddr{
+				Net:  "unix",
+				Name: "/run/src.sock",
+			},
+			DestinationAddr: &net.UnixAddr{
+				Net:  "unix",
+				Name: "/run/dst.sock",
+			},
+		},
+	},
+	// PROXY Unix datagram
+	{
+		newBufioReader(append(append(SIGV2, PROXY, UnixDatagram), fixtureUnixV2...)),
+		&Header{
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: UnixDatagram,
+			SourceAddr: &net.UnixAddr{
+				Net:  "unixgram",
+				Name: "/run/src.sock",
+			},
+			DestinationAddr: &net.UnixAddr{
+				Net:  "unixgram",
+				Name: "/run/dst.sock",
+			},
+		},
+	},
+	// LOCAL UNSPEC
+	{
+		newBufioReader(append(append(SIGV2, LOCAL, UNSPEC), lengthUnspecBytes...)),
+		&Header{
+			Version:           2,
+			Command:           LOCAL,
+			TransportProtocol: UNSPEC,
 		},
 	},
-	// TODO add tests for Unix stream and datagram
 }
 
 func TestParseV2Valid(t *testing.T) {
@@ -261,56 +335,72 @@ var validParseV2PaddedTests = []struct {
 	{
 		append(append(SIGV2, PROXY, TCPv4), fixtureIPv4V2Padded...),
 		&Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  TCPv4,
-			SourceAddress:      v4addr,
-			DestinationAddress: v4addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
-			rawTLVs:            make([]byte, lengthPadded-lengthV4),
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv4,
+			SourceAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
+			rawTLVs: make([]byte, lengthPadded-lengthV4),
 		},
 	},
 	// PROXY TCP IPv6
 	{
 		append(append(SIGV2, PROXY, TCPv6), fixtureIPv6V2Padded...),
 		&Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  TCPv6,
-			SourceAddress:      v6addr,
-			DestinationAddress: v6addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
-			rawTLVs:            make([]byte, lengthPadded-lengthV6),
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: TCPv6,
+			SourceAddr: &net.TCPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.TCPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
+			rawTLVs: make([]byte, lengthPadded-lengthV6),
 		},
 	},
 	// PROXY UDP IPv4
 	{
 		append(append(SIGV2, PROXY, UDPv4), fixtureIPv4V2Padded...),
 		&Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  UDPv4,
-			SourceAddress:      v4addr,
-			DestinationAddress: v4addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
-			rawTLVs:            make([]byte, lengthPadded-lengthV4),
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: UDPv4,
+			SourceAddr: &net.UDPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.UDPAddr{
+				IP:   v4addr,
+				Port: PORT,
+			},
+			rawTLVs: make([]byte, lengthPadded-lengthV4),
 		},
 	},
 	// PROXY UDP IPv6
 	{
 		append(append(SIGV2, PROXY, UDPv6), fixtureIPv6V2Padded...),
 		&Header{
-			Version:            2,
-			Command:            PROXY,
-			TransportProtocol:  UDPv6,
-			SourceAddress:      v6addr,
-			DestinationAddress: v6addr,
-			SourcePort:         PORT,
-			DestinationPort:    PORT,
-			rawTLVs:            make([]byte, lengthPadded-lengthV6),
+			Version:           2,
+			Command:           PROXY,
+			TransportProtocol: UDPv6,
+			SourceAddr: &net.UDPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
+			DestinationAddr: &net.UDPAddr{
+				IP:   v6addr,
+				Port: PORT,
+			},
+			rawTLVs: make([]byte, lengthPadded-lengthV6),
 		},
 	},
 }
@@ -340,13 +430,17 @@ func TestParseV2Padded(t *testing.T) {
 
 func TestV2EqualsToTLV(t *testing.T) {
 	eHdr := &Header{
-		Version:            2,
-		Command:            PROXY,
-		TransportProtocol:  TCPv4,
-		SourceAddress:      v4addr,
-		DestinationAddress: v4addr,
-		SourcePort:         PORT,
-		DestinationPort:    PORT,
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   v4addr,
+			Port: PORT,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   v4addr,
+			Port: PORT,
+		},
 	}
 	hdr, err := Read(newBufioReader(append(append(SIGV2, PROXY, TCPv4), fixtureIPv4V2TLV...)))
 	if err != nil {
@@ -370,47 +464,63 @@ func TestV2EqualsToTLV(t *testing.T) {
 var tlvFormatTests = []*Header{
 	// PROXY TCP IPv4
 	&Header{
-		Version:            2,
-		Command:            PROXY,
-		TransportProtocol:  TCPv4,
-		SourceAddress:      v4addr,
-		DestinationAddress: v4addr,
-		SourcePort:         PORT,
-		DestinationPort:    PORT,
-		rawTLVs:            make([]byte, 1<<16),
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   v4addr,
+			Port: PORT,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   v4addr,
+			Port: PORT,
+		},
+		rawTLVs: make([]byte, 1<<16),
 	},
 	// PROXY TCP IPv6
 	&Header{
-		Version:            2,
-		Command:            PROXY,
-		TransportProtocol:  TCPv6,
-		SourceAddress:      v6addr,
-		DestinationAddress: v6addr,
-		SourcePort:         PORT,
-		DestinationPort:    PORT,
-		rawTLVs:            make([]byte, 1<<16),
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv6,
+		SourceAddr: &net.TCPAddr{
+			IP:   v6addr,
+			Port: PORT,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   v6addr,
+			Port: PORT,
+		},
+		rawTLVs: make([]byte, 1<<16),
 	},
 	// PROXY UDP IPv4
 	&Header{
-		Version:            2,
-		Command:            PROXY,
-		TransportProtocol:  UDPv4,
-		SourceAddress:      v4addr,
-		DestinationAddress: v4addr,
-		SourcePort:         PORT,
-		DestinationPort:    PORT,
-		rawTLVs:            make([]byte, 1<<16),
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: UDPv4,
+		SourceAddr: &net.UDPAddr{
+			IP:   v4addr,
+			Port: PORT,
+		},
+		DestinationAddr: &net.UDPAddr{
+			IP:   v4addr,
+			Port: PORT,
+		},
+		rawTLVs: make([]byte, 1<<16),
 	},
 	// PROXY UDP IPv6
 	&Header{
-		Version:            2,
-		Command:            PROXY,
-		TransportProtocol:  UDPv6,
-		SourceAddress:      v6addr,
-		DestinationAddress: v6addr,
-		SourcePort:         PORT,
-		DestinationPort:    PORT,
-		rawTLVs:            make([]byte, 1<<16),
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: UDPv6,
+		SourceAddr: &net.UDPAddr{
+			IP:   v6addr,
+			Port: PORT,
+		},
+		DestinationAddr: &net.UDPAddr{
+			IP:   v6addr,
+			Port: PORT,
+		},
+		rawTLVs: make([]byte, 1<<16),
 	},
 }
 
@@ -422,6 +532,71 @@ func TestV2TLVFormatTooLargeTLV(t *testing.T) {
 	}
 }
 
+func TestParseV2UnixAddrTypes(t *testing.T) {
+	header, err := Read(newBufioReader(append(append(SIGV2, PROXY, UnixStream), fixtureUnixV2...)))
+	if err != nil {
+		t.Fatal("TestParseV2UnixAddrTypes: unexpected error", err)
+	}
+
+	remoteAddr, ok := header.RemoteAddr().(*net.UnixAddr)
+	if !ok || remoteAddr.Name != "/run/src.sock" {
+		t.Fatalf("TestParseV2UnixAddrTypes: unexpected remote address %#v", header.RemoteAddr())
+	}
+	if _, _, ok := header.TCPAddrs(); ok {
+		t.Fatal("TestParseV2UnixAddrTypes: unexpected TCP addresses")
+	}
+	if _, _, ok := header.IPs(); ok {
+		t.Fatal("TestParseV2UnixAddrTypes: unexpected IPs")
+	}
+}
+
+func TestParseV2UDPAddrTypes(t *testing.T) {
+	header, err := Read(newBufioReader(append(append(SIGV2, PROXY, UDPv4), fixtureIPv4V2...)))
+	if err != nil {
+		t.Fatal("TestParseV2UDPAddrTypes: unexpected error", err)
+	}
+
+	sourceAddr, destAddr, ok := header.UDPAddrs()
+	if !ok {
+		t.Fatalf("TestParseV2UDPAddrTypes: expected UDP addresses, actual %#v", header)
+	}
+	if !sourceAddr.IP.Equal(v4addr) || sourceAddr.Port != PORT || !destAddr.IP.Equal(v4addr) || destAddr.Port != PORT {
+		t.Fatalf("TestParseV2UDPAddrTypes: unexpected addresses %v, %v", sourceAddr, destAddr)
+	}
+}
+
+func TestFormatV2UnixAddrTooLong(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: UnixStream,
+		SourceAddr: &net.UnixAddr{
+			Net:  "unix",
+			Name: "/" + string(bytes.Repeat([]byte{'a'}, 108)),
+		},
+		DestinationAddr: &net.UnixAddr{
+			Net:  "unix",
+			Name: "/run/dst.sock",
+		},
+	}
+
+	if _, err := header.Format(); err != ErrInvalidAddress {
+		t.Fatalf("TestFormatV2UnixAddrTooLong: expected %v, actual %v", ErrInvalidAddress, err)
+	}
+}
+
+func TestFormatV2MissingAddresses(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+	}
+
+	if _, err := header.Format(); err != ErrInvalidAddress {
+		t.Fatalf("TestFormatV2MissingAddresses: expected %v, actual %v", ErrInvalidAddress, err)
+	}
+}
+
 func newBufioReader(b []byte) *bufio.Reader {
 	return bufio.NewReader(bytes.NewReader(b))
 }
@@ -433,3 +608,55 @@ func fixtureWithTLV(cur []byte, addr []byte, tlv []byte) []byte {
 	}
 	return append(append(tlen, addr...), tlv...)
 }
+
+func unixAddressBytes(path string) []byte {
+	b := make([]byte, 108)
+	copy(b, path)
+	return b
+}
+
+func TestReadWithOptionsHeaderTooLarge(t *testing.T) {
+	header := append(append(SIGV2, byte(PROXY), byte(TCPv4)), fixtureIPv4V2TLV...)
+	maxHeaderSize := len(header) - 1
+
+	if _, err := ReadWithOptions(newBufioReader(header), ReadOptions{MaxHeaderSize: maxHeaderSize}); !errors.Is(err, ErrHeaderTooLarge) {
+		t.Fatalf("TestReadWithOptionsHeaderTooLarge: expected %v, actual %v", ErrHeaderTooLarge, err)
+	}
+
+	// The header is rejected before its payload is waited for
+	if _, err := ReadWithOptions(newBufioReader(header[:16]), ReadOptions{MaxHeaderSize: maxHeaderSize}); !errors.Is(err, ErrHeaderTooLarge) {
+		t.Fatalf("TestReadWithOptionsHeaderTooLarge: expected %v, actual %v", ErrHeaderTooLarge, err)
+	}
+
+	if _, err := ReadWithOptions(newBufioReader(header), ReadOptions{MaxHeaderSize: len(header)}); err != nil {
+		t.Fatalf("TestReadWithOptionsHeaderTooLarge: unexpected error %v", err)
+	}
+}
+
+func TestReadWithOptionsTooManyTLVs(t *testing.T) {
+	header := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr:        &net.TCPAddr{IP: v4addr, Port: PORT},
+		DestinationAddr:   &net.TCPAddr{IP: v4addr, Port: PORT},
+	}
+	if err := header.SetTLVs([]TLV{
+		{Type: PP2_TYPE_ALPN, Value: []byte("h2")},
+		{Type: PP2_TYPE_AUTHORITY, Value: []byte("example.org")},
+		{Type: PP2_TYPE_NOOP, Length: 4},
+	}); err != nil {
+		t.Fatalf("TestReadWithOptionsTooManyTLVs: unexpected error %v", err)
+	}
+	raw, err := header.Format()
+	if err != nil {
+		t.Fatalf("TestReadWithOptionsTooManyTLVs: unexpected error %v", err)
+	}
+
+	if _, err := ReadWithOptions(newBufioReader(raw), ReadOptions{MaxTLVs: 2}); !errors.Is(err, ErrTooManyTLVs) {
+		t.Fatalf("TestReadWithOptionsTooManyTLVs: expected %v, actual %v", ErrTooManyTLVs, err)
+	}
+	if _, err := ReadWithOptions(newBufioReader(raw), ReadOptions{MaxTLVs: 3}); err != nil {
+		t.Fatalf("TestReadWithOptionsTooManyTLVs: unexpected error %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package proxyproto
+
+import "errors"
+
+var (
+	ErrNoValidatorAccepted         = errors.New("No validator accepted the proxy protocol header")
+	ErrVersionNotAllowed           = errors.New("Proxy protocol version not allowed")
+	ErrTransportProtocolNotAllowed = errors.New("Transport protocol not allowed")
+	ErrSourceAddressNotAllowed     = errors.New("Source address not allowed")
+	ErrDestinationPortNotAllowed   = errors.New("Destination port not allowed")
+	ErrMissingTLV                  = errors.New("Required TLV missing")
+)
+
+// AllOf returns a Validator which accepts a header if all the given
+// validators accept it. It returns the error of the first one rejecting it.
+func AllOf(validators ...Validator) Validator {
+	return func(header *Header) error {
+		for _, validator := range validators {
+			if validator == nil {
+				continue
+			}
+			if err := validator(header); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// AnyOf returns a Validator which accepts a header if at least one of the
+// given validators accepts it. Otherwise, it returns the error of the last
+// validator, or ErrNoValidatorAccepted if there is none.
+func AnyOf(validators ...Validator) Validator {
+	return func(header *Header) error {
+		err := ErrNoValidatorAccepted
+		for _, validator := range validators {
+			if validator == nil {
+				continue
+			}
+			if err = validator(header); err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+}
+
+// RequireVersion2 is a Validator which rejects v1 headers.
+func RequireVersion2(header *Header) error {
+	if header.Version != 2 {
+		return ErrVersionNotAllowed
+	}
+	return nil
+}
+
+// RequireTransportProtocol returns a Validator which rejects headers whose
+// transport protocol isn't one of the given ones. LOCAL headers are
+// accepted, as they don't carry a proxied connection.
+func RequireTransportProtocol(protocols ...AddressFamilyAndProtocol) Validator {
+	return func(header *Header) error {
+		if header.Command.IsLocal() {
+			return nil
+		}
+		for _, protocol := range protocols {
+			if header.TransportProtocol == protocol {
+				return nil
+			}
+		}
+		return ErrTransportProtocolNotAllowed
+	}
+}
+
+// SourceAddrInCIDRs returns a Validator which rejects headers whose source
+// IP isn't one of the allowed IP addresses or within one of the allowed IP
+// ranges. Headers without a source IP, e.g. for Unix sockets, are rejected
+// while LOCAL headers are accepted. If one of the provided IP addresses or
+// IP ranges is invalid it will return an error instead of a Validator.
+func SourceAddrInCIDRs(allowed []string) (Validator, error) {
+	allowFrom, err := parse(allowed)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(header *Header) error {
+		if header.Command.IsLocal() {
+			return nil
+		}
+		sourceIP, _, ok := header.IPs()
+		if !ok {
+			return ErrSourceAddressNotAllowed
+		}
+		if allowFrom.containsIP(sourceIP) {
+			return nil
+		}
+		return ErrSourceAddressNotAllowed
+	}, nil
+}
+
+// MustSourceAddrInCIDRs returns a SourceAddrInCIDRs but will panic if one
+// of the provided IP addresses or IP ranges is invalid.
+func MustSourceAddrInCIDRs(allowed []string) Validator {
+	validator, err := SourceAddrInCIDRs(allowed)
+	if err != nil {
+		panic(err)
+	}
+
+	return validator
+}
+
+// RequireDestinationPort returns a Validator which rejects headers whose
+// destination port isn't one of the given ones. Headers without a port,
+// e.g. for Unix sockets, are rejected while LOCAL headers are accepted.
+func RequireDestinationPort(ports ...int) Validator {
+	return func(header *Header) error {
+		if header.Command.IsLocal() {
+			return nil
+		}
+		_, destPort, ok := header.Ports()
+		if !ok {
+			return ErrDestinationPortNotAllowed
+		}
+		for _, port := range ports {
+			if destPort == port {
+				return nil
+			}
+		}
+		return ErrDestinationPortNotAllowed
+	}
+}
+
+// RequireTLVs returns a Validator which rejects headers which don't carry a
+// TLV of each of the given types, or whose TLVs are malformed. LOCAL headers
+// are accepted.
+func RequireTLVs(types ...PP2Type) Validator {
+	return func(header *Header) error {
+		if header.Command.IsLocal() {
+			return nil
+		}
+		tlvs, err := header.TLVs()
+		if err != nil {
+			return err
+		}
+		for _, t := range types {
+			if !hasTLV(tlvs, t) {
+				return ErrMissingTLV
+			}
+		}
+		return nil
+	}
+}
+
+func hasTLV(tlvs []TLV, t PP2Type) bool {
+	for _, tlv := range tlvs {
+		if tlv.Type == t {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,147 @@
+package proxyproto
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func validatorsTestHeader() *Header {
+	return &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: TCPv4,
+		SourceAddr: &net.TCPAddr{
+			IP:   net.ParseIP("10.1.1.1"),
+			Port: 1000,
+		},
+		DestinationAddr: &net.TCPAddr{
+			IP:   net.ParseIP("20.2.2.2"),
+			Port: 2000,
+		},
+	}
+}
+
+func TestAllOf(t *testing.T) {
+	failure := errors.New("failure")
+	accept := func(*Header) error { return nil }
+	reject := func(*Header) error { return failure }
+
+	header := validatorsTestHeader()
+	if err := AllOf()(header); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := AllOf(accept, nil, accept)(header); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := AllOf(accept, reject)(header); err != failure {
+		t.Fatalf("expected %v, actual %v", failure, err)
+	}
+}
+
+func TestAnyOf(t *testing.T) {
+	failure := errors.New("failure")
+	accept := func(*Header) error { return nil }
+	reject := func(*Header) error { return failure }
+
+	header := validatorsTestHeader()
+	if err := AnyOf()(header); err != ErrNoValidatorAccepted {
+		t.Fatalf("expected %v, actual %v", ErrNoValidatorAccepted, err)
+	}
+	if err := AnyOf(reject, nil, accept)(header); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := AnyOf(reject, reject)(header); err != failure {
+		t.Fatalf("expected %v, actual %v", failure, err)
+	}
+}
+
+func TestRequireVersion2(t *testing.T) {
+	header := validatorsTestHeader()
+	if err := RequireVersion2(header); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	header.Version = 1
+	if err := RequireVersion2(header); err != ErrVersionNotAllowed {
+		t.Fatalf("expected %v, actual %v", ErrVersionNotAllowed, err)
+	}
+}
+
+func TestRequireTransportProtocol(t *testing.T) {
+	header := validatorsTestHeader()
+	if err := RequireTransportProtocol(TCPv4, TCPv6)(header); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := RequireTransportProtocol(UDPv4)(header); err != ErrTransportProtocolNotAllowed {
+		t.Fatalf("expected %v, actual %v", ErrTransportProtocolNotAllowed, err)
+	}
+}
+
+func TestSourceAddrInCIDRs(t *testing.T) {
+	if _, err := SourceAddrInCIDRs([]string{"10.0.0.0/33"}); err == nil {
+		t.Fatal("expected an error for an invalid IP range")
+	}
+
+	validator := MustSourceAddrInCIDRs([]string{"10.0.0.0/8", "30.3.3.3"})
+
+	header := validatorsTestHeader()
+	if err := validator(header); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	header.SourceAddr = &net.TCPAddr{IP: net.ParseIP("30.3.3.4"), Port: 1000}
+	if err := validator(header); err != ErrSourceAddressNotAllowed {
+		t.Fatalf("expected %v, actual %v", ErrSourceAddressNotAllowed, err)
+	}
+
+	unix := &Header{
+		Version:           2,
+		Command:           PROXY,
+		TransportProtocol: UnixStream,
+		SourceAddr:        &net.UnixAddr{Net: "unix", Name: "/run/src.sock"},
+		DestinationAddr:   &net.UnixAddr{Net: "unix", Name: "/run/dst.sock"},
+	}
+	if err := validator(unix); err != ErrSourceAddressNotAllowed {
+		t.Fatalf("expected %v, actual %v", ErrSourceAddressNotAllowed, err)
+	}
+}
+
+func TestRequireDestinationPort(t *testing.T) {
+	header := validatorsTestHeader()
+	if err := RequireDestinationPort(443, 2000)(header); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := RequireDestinationPort(443)(header); err != ErrDestinationPortNotAllowed {
+		t.Fatalf("expected %v, actual %v", ErrDestinationPortNotAllowed, err)
+	}
+}
+
+func TestRequireTLVs(t *testing.T) {
+	header := validatorsTestHeader()
+	if err := header.SetTLVs([]TLV{{Type: PP2_TYPE_ALPN, Value: []byte("h2")}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if err := RequireTLVs(PP2_TYPE_ALPN)(header); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := RequireTLVs(PP2_TYPE_ALPN, PP2_TYPE_AUTHORITY)(header); err != ErrMissingTLV {
+		t.Fatalf("expected %v, actual %v", ErrMissingTLV, err)
+	}
+}
+
+func TestValidatorsAcceptLocalHeaders(t *testing.T) {
+	local := &Header{Version: 2, Command: LOCAL, TransportProtocol: UNSPEC}
+
+	validator := AllOf(
+		RequireVersion2,
+		RequireTransportProtocol(TCPv4),
+		MustSourceAddrInCIDRs([]string{"10.0.0.0/8"}),
+		RequireDestinationPort(443),
+		RequireTLVs(PP2_TYPE_ALPN),
+	)
+	if err := validator(local); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+}